@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/anacrolix/torrent"
@@ -44,6 +46,7 @@ type args struct {
 	PubIPv6     string `arg:"-6" help:"set public IPv6 addr"`
 	SearchWA    bool   `arg:"-s" help:"search without auth"`
 	MaxSize     string `arg:"-m" help:"max allowed stream size (in Bytes)"`
+	StopTimeout int    `help:"seconds to wait active streams on shutdown (default 30)"`
 }
 
 func (args) Version() string {
@@ -114,13 +117,35 @@ func main() {
 		}
 	}
 
+	if params.StopTimeout > 0 {
+		settings.ShutdownTimeout = time.Duration(params.StopTimeout) * time.Second
+	}
+
+	if !params.DontKill {
+		stopOnSignal()
+	}
+
 	server.Start(params.Port, params.IP, params.SslPort, params.SslCert, params.SslKey, params.Ssl, params.RDB, params.SearchWA)
 	log.TLogln(server.WaitServer())
+	server.Stop()
 	log.Close()
-	time.Sleep(time.Second * 3)
 	os.Exit(0)
 }
 
+// stopOnSignal gracefully stops server on first interrupt or terminate signal and kills it on second one
+func stopOnSignal() {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sigc
+		log.TLogln("Signal catched:", s, "stop server")
+		go server.Stop()
+		s = <-sigc
+		log.TLogln("Signal catched:", s, "kill server")
+		os.Exit(1)
+	}()
+}
+
 func dnsResolve() {
 	addrs, err := net.LookupHost("www.google.com")
 	if len(addrs) == 0 {
@@ -10,13 +10,23 @@ import (
 
 	"server/log"
 	"server/settings"
+	"server/web/auth"
 )
 
 func Preconfig(dkill bool) {
+	// reload accounts on SIGHUP
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			log.TLogln("Signal catched: hangup, reload accounts")
+			auth.Reload()
+		}
+	}()
+
 	if dkill {
 		sigc := make(chan os.Signal, 1)
 		signal.Notify(sigc,
-			syscall.SIGHUP,
 			syscall.SIGINT,
 			syscall.SIGPIPE,
 			syscall.SIGTERM,
@@ -0,0 +1,236 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"server/log"
+	mt "server/mimetype"
+	"server/settings"
+	"server/torr"
+	"server/web/auth"
+)
+
+const (
+	rootID         = "0"
+	dlnaFlags      = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+	didlLiteHeader = `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">`
+)
+
+type didlObject struct {
+	XMLName    xml.Name
+	ID         string   `xml:"id,attr"`
+	ParentID   string   `xml:"parentID,attr"`
+	Restricted int      `xml:"restricted,attr"`
+	ChildCount int      `xml:"childCount,attr,omitempty"`
+	Title      string   `xml:"dc:title"`
+	Class      string   `xml:"upnp:class"`
+	AlbumArt   string   `xml:"upnp:albumArtURI,omitempty"`
+	Res        *didlRes `xml:"res,omitempty"`
+}
+
+type didlRes struct {
+	ProtocolInfo string `xml:"protocolInfo,attr"`
+	Size         int64  `xml:"size,attr,omitempty"`
+	Duration     string `xml:"duration,attr,omitempty"`
+	Resolution   string `xml:"resolution,attr,omitempty"`
+	URL          string `xml:",chardata"`
+}
+
+type upnpError struct {
+	Code        int
+	Description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("upnp error %d: %s", e.Code, e.Description)
+}
+
+var (
+	errInvalidAction = &upnpError{401, "Invalid Action"}
+	errInvalidArgs   = &upnpError{402, "Invalid Args"}
+	errNoSuchObject  = &upnpError{701, "No such object"}
+)
+
+// browse handles ContentDirectory Browse, object ids are 0 for root, hash for torrent and hash/id for file
+func browse(dev *device, host string, args map[string]string) ([]string, error) {
+	start, err := strconv.Atoi(args["StartingIndex"])
+	if err != nil || start < 0 {
+		return nil, errInvalidArgs
+	}
+	count, err := strconv.Atoi(args["RequestedCount"])
+	if err != nil || count < 0 {
+		return nil, errInvalidArgs
+	}
+	objectID := args["ObjectID"]
+
+	var objs []*didlObject
+	switch args["BrowseFlag"] {
+	case "BrowseMetadata":
+		obj := metadata(dev, host, objectID)
+		if obj == nil {
+			return nil, errNoSuchObject
+		}
+		objs = []*didlObject{obj}
+	case "BrowseDirectChildren":
+		var ok bool
+		if objs, ok = children(dev, host, objectID); !ok {
+			return nil, errNoSuchObject
+		}
+	default:
+		return nil, errInvalidArgs
+	}
+
+	total := len(objs)
+	if start > total {
+		start = total
+	}
+	objs = objs[start:]
+	if count > 0 && count < len(objs) {
+		objs = objs[:count]
+	}
+
+	var b strings.Builder
+	b.WriteString(didlLiteHeader)
+	for _, obj := range objs {
+		buf, err := xml.Marshal(obj)
+		if err != nil {
+			log.TLogln("Error marshal DIDL object", obj.ID, err)
+			continue
+		}
+		b.Write(buf)
+	}
+	b.WriteString("</DIDL-Lite>")
+
+	return []string{
+		"Result", b.String(),
+		"NumberReturned", strconv.Itoa(len(objs)),
+		"TotalMatches", strconv.Itoa(total),
+		"UpdateID", strconv.FormatUint(uint64(systemUpdateID), 10),
+	}, nil
+}
+
+func metadata(dev *device, host, objectID string) *didlObject {
+	if objectID == rootID {
+		return &didlObject{
+			XMLName:    xml.Name{Local: "container"},
+			ID:         rootID,
+			ParentID:   "-1",
+			Restricted: 1,
+			ChildCount: len(torr.ListTorrent(dev.User)),
+			Title:      dev.Name,
+			Class:      "object.container.storageFolder",
+		}
+	}
+	hash, id, isFile := strings.Cut(objectID, "/")
+	tor := findTorrent(dev.User, hash)
+	if tor == nil {
+		return nil
+	}
+	if !isFile {
+		return torrentContainer(dev, tor)
+	}
+	for _, obj := range fileItems(dev, host, tor) {
+		if obj.ID == hash+"/"+id {
+			return obj
+		}
+	}
+	return nil
+}
+
+func children(dev *device, host, objectID string) ([]*didlObject, bool) {
+	if objectID == rootID {
+		var list []*didlObject
+		for _, tor := range torr.ListTorrent(dev.User) {
+			list = append(list, torrentContainer(dev, tor))
+		}
+		return list, true
+	}
+	tor := findTorrent(dev.User, objectID)
+	if tor == nil {
+		return nil, false
+	}
+	return fileItems(dev, host, tor), true
+}
+
+func findTorrent(user, hash string) *torr.Torrent {
+	for _, tor := range torr.ListTorrent(user) {
+		if tor.Hash().HexString() == hash {
+			return tor
+		}
+	}
+	return nil
+}
+
+func torrentContainer(dev *device, tor *torr.Torrent) *didlObject {
+	title := tor.Title
+	if title == "" {
+		title = tor.TorrentSpec.DisplayName
+	}
+	if title == "" {
+		title = tor.Hash().HexString()
+	}
+	return &didlObject{
+		XMLName:    xml.Name{Local: "container"},
+		ID:         tor.Hash().HexString(),
+		ParentID:   rootID,
+		Restricted: 1,
+		Title:      title,
+		Class:      "object.container.storageFolder",
+		AlbumArt:   tor.Poster,
+	}
+}
+
+func fileItems(dev *device, host string, tor *torr.Torrent) []*didlObject {
+	hash := tor.Hash().HexString()
+	token := ""
+	if settings.HttpAuth {
+		token = "?token=" + auth.StreamToken(dev.User, hash)
+	}
+	var list []*didlObject
+	for _, f := range torr.TorrentFiles(dev.User, tor) {
+		mime, err := mt.MimeTypeByPath(f.Path)
+		if err != nil || !mime.IsMedia() {
+			continue
+		}
+		obj := &didlObject{
+			XMLName:    xml.Name{Local: "item"},
+			ID:         hash + "/" + strconv.Itoa(f.Id),
+			ParentID:   hash,
+			Restricted: 1,
+			Title:      f.Path[strings.LastIndex(f.Path, "/")+1:],
+			Res: &didlRes{
+				ProtocolInfo: "http-get:*:" + mime.String() + ":" + dlnaFlags,
+				Size:         f.Length,
+				URL:          "http://" + host + "/dlna/" + dev.UUID + "/res/" + hash + "/" + strconv.Itoa(f.Id) + token,
+			},
+		}
+		switch {
+		case mime.IsVideo():
+			obj.Class = "object.item.videoItem"
+		case mime.IsAudio():
+			obj.Class = "object.item.audioItem.musicTrack"
+		default:
+			obj.Class = "object.item.imageItem.photo"
+		}
+		if f.Media != nil {
+			obj.Res.Duration = formatDuration(f.Media.DurationSeconds)
+			if f.Media.Width > 0 {
+				obj.Res.Resolution = strconv.Itoa(f.Media.Width) + "x" + strconv.Itoa(f.Media.Height)
+			}
+		}
+		list = append(list, obj)
+	}
+	return list
+}
+
+// formatDuration formats seconds as H:MM:SS.mmm used in DIDL res duration
+func formatDuration(sec float64) string {
+	if sec <= 0 {
+		return ""
+	}
+	ms := int64(sec * 1000)
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,177 @@
+package dlna
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"server/log"
+	"server/settings"
+	"server/version"
+	"server/web/auth"
+)
+
+// device is DLNA MediaServer of one account, all devices share one ssdp socket and http server
+type device struct {
+	UUID string
+	User string
+	Name string
+}
+
+var (
+	ssdp    *ssdpServer
+	muSSDP  sync.Mutex
+	stopped chan struct{}
+	localIP string
+)
+
+// Start announces DLNA media servers of all accounts when EnableDLNA is set
+func Start(ips []string) {
+	if !settings.BTsets.EnableDLNA {
+		return
+	}
+	muSSDP.Lock()
+	defer muSSDP.Unlock()
+	if ssdp != nil {
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		log.TLogln("Error start DLNA:", err)
+		return
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, addr)
+	if err != nil {
+		log.TLogln("Error start DLNA:", err)
+		return
+	}
+	for _, ip := range ips {
+		if p := net.ParseIP(ip); p != nil && p.To4() != nil {
+			localIP = ip
+			break
+		}
+	}
+	ssdp = &ssdpServer{
+		conn:     conn,
+		devices:  devices,
+		location: location,
+		server:   serverName(),
+	}
+	stopped = make(chan struct{})
+	go ssdp.serve()
+	go advertise(ssdp, stopped)
+	log.TLogln("DLNA started, devices:", len(devices()))
+}
+
+// Stop sends ssdp:byebye and closes ssdp socket
+func Stop() {
+	muSSDP.Lock()
+	defer muSSDP.Unlock()
+	if ssdp == nil {
+		return
+	}
+	close(stopped)
+	if localIP != "" {
+		ssdp.notify("ssdp:byebye", deviceURL(localIP, "{uuid}"))
+	}
+	ssdp.conn.Close()
+	ssdp = nil
+	log.TLogln("DLNA stopped")
+}
+
+func advertise(s *ssdpServer, stop chan struct{}) {
+	if localIP == "" {
+		return
+	}
+	ticker := time.NewTicker(ssdpMaxAge / 2 * time.Second)
+	defer ticker.Stop()
+	for {
+		s.notify("ssdp:alive", deviceURL(localIP, "{uuid}"))
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// devices returns media server of each enabled account with DLNA opt-in or single server without auth
+func devices() []*device {
+	users := []string{""}
+	if settings.HttpAuth {
+		users = auth.Users()
+	}
+	list := make([]*device, 0, len(users))
+	for _, user := range users {
+		if user != "" && !exposed(user) {
+			continue
+		}
+		list = append(list, &device{UUID: deviceUUID(user), User: user, Name: friendlyName(user)})
+	}
+	return list
+}
+
+// exposed reports whether account opted in to DLNA, any LAN client can browse its library
+func exposed(user string) bool {
+	sets := settings.GetUserBTSets(user)
+	return sets != nil && sets.DLNA != nil && *sets.DLNA
+}
+
+func findDevice(uuid string) *device {
+	for _, dev := range devices() {
+		if dev.UUID == uuid {
+			return dev
+		}
+	}
+	return nil
+}
+
+// uuidSecret keys device uuids, so uuid of account can't be computed from its name,
+// uuid is announced to whole network and doesn't restrict access to the library
+var uuidSecret = settings.TokenSecret
+
+// deviceUUID is stable keyed uuid of account, so TVs keep found servers after restart
+func deviceUUID(user string) string {
+	mac := hmac.New(sha1.New, uuidSecret())
+	mac.Write([]byte("TorrServer DLNA " + user))
+	sum := mac.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func friendlyName(user string) string {
+	name := settings.BTsets.FriendlyName
+	if name == "" {
+		name = "TorrServer"
+	}
+	if user != "" {
+		name += " (" + user + ")"
+	}
+	return name
+}
+
+func serverName() string {
+	return runtime.GOOS + "/" + runtime.GOARCH + " UPnP/1.0 DLNADOC/1.50 TorrServer/" + version.Version
+}
+
+// location returns description url with local address seen by remote client
+func location(dev *device, remote net.Addr) string {
+	ip := settings.IP
+	if ip == "" || ip == "0.0.0.0" {
+		ip = localIP
+		if conn, err := net.Dial("udp4", remote.String()); err == nil {
+			ip = conn.LocalAddr().(*net.UDPAddr).IP.String()
+			conn.Close()
+		}
+	}
+	return deviceURL(ip, dev.UUID)
+}
+
+func deviceURL(ip, uuid string) string {
+	return "http://" + net.JoinHostPort(ip, settings.Port) + "/dlna/" + uuid + "/rootDesc.xml"
+}
@@ -0,0 +1,218 @@
+package dlna
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/log"
+	"server/settings"
+	"server/torr"
+	"server/torr/state"
+	"server/web/auth"
+)
+
+// systemUpdateID changes on every start, so clients don't keep stale cached lists
+var systemUpdateID = uint32(time.Now().Unix())
+
+type soapEnvelope struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// SetupRoute registers DLNA device description, control and media urls, they have no http auth
+// because TVs can't send it, so only local network clients are allowed and only accounts with
+// DLNA opt-in have devices. Media urls are signed with stream token.
+func SetupRoute(route gin.IRouter) {
+	dlna := route.Group("/dlna/:uuid", localNetwork(), findDeviceParam())
+	dlna.GET("/rootDesc.xml", func(c *gin.Context) {
+		c.Data(200, `text/xml; charset="utf-8"`, []byte(rootDesc(c.MustGet("dlna_device").(*device))))
+	})
+	dlna.GET("/cds.xml", func(c *gin.Context) {
+		c.Data(200, `text/xml; charset="utf-8"`, []byte(cdsSCPD))
+	})
+	dlna.GET("/cms.xml", func(c *gin.Context) {
+		c.Data(200, `text/xml; charset="utf-8"`, []byte(cmsSCPD))
+	})
+	dlna.POST("/control/:service", control)
+	dlna.Handle("SUBSCRIBE", "/event/:service", subscribe)
+	dlna.Handle("UNSUBSCRIBE", "/event/:service", func(c *gin.Context) {
+		c.Status(200)
+	})
+	dlna.GET("/res/:hash/:id", resource)
+	dlna.HEAD("/res/:hash/:id", resource)
+}
+
+func localNetwork() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !settings.BTsets.EnableDLNA {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		// RemoteIP is address of connection, ClientIP trusts X-Forwarded-For of any client
+		ip := net.ParseIP(c.RemoteIP())
+		if ip == nil || !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+func findDeviceParam() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dev := findDevice(c.Param("uuid"))
+		if dev == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Set("dlna_device", dev)
+		c.Next()
+	}
+}
+
+func control(c *gin.Context) {
+	dev := c.MustGet("dlna_device").(*device)
+	service := "ContentDirectory"
+	if c.Param("service") == "cms" {
+		service = "ConnectionManager"
+	}
+
+	_, action, _ := strings.Cut(strings.Trim(c.GetHeader("SOAPAction"), `"`), "#")
+	var env soapEnvelope
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err == nil {
+		err = xml.Unmarshal(body, &env)
+	}
+	if err != nil {
+		soapFault(c, errInvalidArgs)
+		return
+	}
+	if action == "" {
+		action = env.Body.Action.XMLName.Local
+	}
+	args := make(map[string]string)
+	for _, arg := range env.Body.Action.Args {
+		args[arg.XMLName.Local] = arg.Value
+	}
+
+	var ret []string
+	switch service + "#" + action {
+	case "ContentDirectory#Browse":
+		ret, err = browse(dev, c.Request.Host, args)
+	case "ContentDirectory#GetSearchCapabilities":
+		ret = []string{"SearchCaps", ""}
+	case "ContentDirectory#GetSortCapabilities":
+		ret = []string{"SortCaps", ""}
+	case "ContentDirectory#GetSystemUpdateID":
+		ret = []string{"Id", strconv.FormatUint(uint64(systemUpdateID), 10)}
+	case "ConnectionManager#GetProtocolInfo":
+		ret = []string{"Source", "http-get:*:*:*", "Sink", ""}
+	case "ConnectionManager#GetCurrentConnectionIDs":
+		ret = []string{"ConnectionIDs", "0"}
+	default:
+		err = errInvalidAction
+	}
+	if err != nil {
+		if settings.BTsets.EnableDebug {
+			log.TLogln("DLNA", dev.User, service, action, err)
+		}
+		soapFault(c, err)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	b.WriteString(`<u:` + action + `Response xmlns:u="urn:schemas-upnp-org:service:` + service + `:1">`)
+	for i := 0; i+1 < len(ret); i += 2 {
+		b.WriteString("<" + ret[i] + ">" + xmlEscape(ret[i+1]) + "</" + ret[i] + ">")
+	}
+	b.WriteString(`</u:` + action + `Response></s:Body></s:Envelope>`)
+	c.Header("EXT", "")
+	c.Data(200, `text/xml; charset="utf-8"`, []byte(b.String()))
+}
+
+func soapFault(c *gin.Context, err error) {
+	var uerr *upnpError
+	if !errors.As(err, &uerr) {
+		uerr = &upnpError{501, "Action Failed"}
+	}
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>` +
+		`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>` +
+		`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>` + strconv.Itoa(uerr.Code) + `</errorCode>` +
+		`<errorDescription>` + xmlEscape(uerr.Description) + `</errorDescription></UPnPError>` +
+		`</detail></s:Fault></s:Body></s:Envelope>`
+	c.Data(http.StatusInternalServerError, `text/xml; charset="utf-8"`, []byte(body))
+}
+
+// subscribe accepts event subscriptions, some TVs don't browse without it, events are not sent
+func subscribe(c *gin.Context) {
+	sid := c.GetHeader("SID")
+	if sid == "" {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		sid = "uuid:" + hex.EncodeToString(buf)
+	}
+	c.Header("SID", sid)
+	c.Header("TIMEOUT", "Second-"+strconv.Itoa(ssdpMaxAge))
+	c.Status(200)
+}
+
+func resource(c *gin.Context) {
+	dev := c.MustGet("dlna_device").(*device)
+	index, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	// media urls are signed like playlist links
+	if settings.HttpAuth && !auth.VerifyStreamToken(c.Query("token"), dev.User, c.Param("hash")) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	tor := torr.GetTorrent(dev.User, c.Param("hash"))
+	if tor == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if tor.Stat == state.TorrentInDB {
+		tor, err = torr.AddTorrent(dev.User, tor.TorrentSpec, tor.Title, tor.Poster, tor.Data, tor.Category)
+		if err != nil {
+			status := torr.QuotaStatus(err)
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			c.AbortWithError(status, err)
+			return
+		}
+	}
+	if !tor.GotInfo() {
+		c.AbortWithError(http.StatusInternalServerError, errors.New("timeout connection torrent"))
+		return
+	}
+
+	if c.GetHeader("getcontentFeatures.dlna.org") != "" {
+		c.Header("contentFeatures.dlna.org", dlnaFlags)
+	}
+	c.Header("transferMode.dlna.org", "Streaming")
+	tor.Stream(index, c.Request, c.Writer, dev.User)
+}
@@ -0,0 +1,48 @@
+package dlna
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"server/settings"
+)
+
+func init() {
+	// settings db is not opened in tests
+	uuidSecret = func() []byte { return []byte("test secret") }
+}
+
+func TestLocalNetwork(t *testing.T) {
+	old := settings.BTsets
+	settings.BTsets = &settings.BTSets{EnableDLNA: true}
+	t.Cleanup(func() { settings.BTsets = old })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/dlna", localNetwork(), func(c *gin.Context) { c.Status(200) })
+
+	tests := []struct {
+		remote, forwarded string
+		want              int
+	}{
+		{"192.168.1.5:5000", "", 200},
+		{"127.0.0.1:5000", "", 200},
+		{"8.8.8.8:5000", "", 403},
+		{"8.8.8.8:5000", "192.168.1.5", 403}, // forwarded address is not trusted
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/dlna", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s forwarded %q: status %d, want %d", tt.remote, tt.forwarded, w.Code, tt.want)
+		}
+	}
+}
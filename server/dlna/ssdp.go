@@ -0,0 +1,115 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/log"
+)
+
+const (
+	ssdpAddr   = "239.255.255.250:1900"
+	ssdpMaxAge = 1800 // in seconds
+)
+
+var ssdpTargets = []string{
+	"upnp:rootdevice",
+	"urn:schemas-upnp-org:device:MediaServer:1",
+	"urn:schemas-upnp-org:service:ContentDirectory:1",
+	"urn:schemas-upnp-org:service:ConnectionManager:1",
+}
+
+// ssdpServer answers M-SEARCH requests and advertises devices, conn is multicast socket in
+// production and plain udp socket in tests
+type ssdpServer struct {
+	conn     net.PacketConn
+	devices  func() []*device
+	location func(dev *device, remote net.Addr) string
+	server   string
+}
+
+func (s *ssdpServer) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.handle(buf[:n], from)
+	}
+}
+
+func (s *ssdpServer) handle(data []byte, from net.Addr) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil || req.Method != "M-SEARCH" || req.Header.Get("Man") != `"ssdp:discover"` {
+		return
+	}
+	st := req.Header.Get("St")
+	for _, dev := range s.devices() {
+		for _, target := range dev.targets() {
+			if st != "ssdp:all" && st != target {
+				continue
+			}
+			if _, err := s.conn.WriteTo(s.response(dev, target, from), from); err != nil {
+				log.TLogln("Error send ssdp response", from, err)
+				return
+			}
+		}
+	}
+}
+
+func (s *ssdpServer) response(dev *device, target string, from net.Addr) []byte {
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 200 OK\r\n")
+	b.WriteString(fmt.Sprintf("CACHE-CONTROL: max-age=%d\r\n", ssdpMaxAge))
+	b.WriteString("DATE: " + time.Now().UTC().Format(http.TimeFormat) + "\r\n")
+	b.WriteString("EXT:\r\n")
+	b.WriteString("LOCATION: " + s.location(dev, from) + "\r\n")
+	b.WriteString("SERVER: " + s.server + "\r\n")
+	b.WriteString("ST: " + target + "\r\n")
+	b.WriteString("USN: " + dev.usn(target) + "\r\n")
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// notify sends ssdp:alive or ssdp:byebye of all devices to multicast group
+func (s *ssdpServer) notify(nts string, location string) {
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return
+	}
+	for _, dev := range s.devices() {
+		for _, target := range dev.targets() {
+			var b strings.Builder
+			b.WriteString("NOTIFY * HTTP/1.1\r\n")
+			b.WriteString("HOST: " + ssdpAddr + "\r\n")
+			b.WriteString(fmt.Sprintf("CACHE-CONTROL: max-age=%d\r\n", ssdpMaxAge))
+			b.WriteString("LOCATION: " + strings.Replace(location, "{uuid}", dev.UUID, 1) + "\r\n")
+			b.WriteString("NT: " + target + "\r\n")
+			b.WriteString("NTS: " + nts + "\r\n")
+			b.WriteString("SERVER: " + s.server + "\r\n")
+			b.WriteString("USN: " + dev.usn(target) + "\r\n")
+			b.WriteString("\r\n")
+			if _, err := s.conn.WriteTo([]byte(b.String()), addr); err != nil {
+				log.TLogln("Error send ssdp notify", err)
+				return
+			}
+		}
+	}
+}
+
+func (d *device) targets() []string {
+	return append([]string{"uuid:" + d.UUID}, ssdpTargets...)
+}
+
+func (d *device) usn(target string) string {
+	if target == "uuid:"+d.UUID {
+		return target
+	}
+	return "uuid:" + d.UUID + "::" + target
+}
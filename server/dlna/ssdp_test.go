@@ -0,0 +1,127 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSDP starts ssdp server on loopback udp socket with given devices
+func fakeSSDP(t *testing.T, devs ...*device) *ssdpServer {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s := &ssdpServer{
+		conn:    conn,
+		devices: func() []*device { return devs },
+		location: func(dev *device, remote net.Addr) string {
+			return "http://127.0.0.1:8090/dlna/" + dev.UUID + "/rootDesc.xml"
+		},
+		server: "test UPnP/1.0 TorrServer/test",
+	}
+	go s.serve()
+	return s
+}
+
+// search sends M-SEARCH like a TV does and collects responses until timeout
+func search(t *testing.T, server net.Addr, st string) []*http.Response {
+	client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + st + "\r\n\r\n"
+	if _, err = client.WriteTo([]byte(req), server); err != nil {
+		t.Fatal(err)
+	}
+
+	var list []*http.Response
+	buf := make([]byte, 2048)
+	for {
+		client.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		n, _, err := client.ReadFrom(buf)
+		if err != nil {
+			return list
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, resp)
+	}
+}
+
+func TestSSDPSearchMediaServer(t *testing.T) {
+	dev := &device{UUID: deviceUUID("user1"), User: "user1", Name: "TorrServer (user1)"}
+	s := fakeSSDP(t, dev)
+
+	list := search(t, s.conn.LocalAddr(), "urn:schemas-upnp-org:device:MediaServer:1")
+	if len(list) != 1 {
+		t.Fatalf("got %d responses, want 1", len(list))
+	}
+	resp := list[0]
+	if resp.StatusCode != 200 {
+		t.Errorf("status %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("St"); got != "urn:schemas-upnp-org:device:MediaServer:1" {
+		t.Errorf("ST %q", got)
+	}
+	if got, want := resp.Header.Get("Usn"), "uuid:"+dev.UUID+"::urn:schemas-upnp-org:device:MediaServer:1"; got != want {
+		t.Errorf("USN %q, want %q", got, want)
+	}
+	if got := resp.Header.Get("Location"); !strings.Contains(got, "/dlna/"+dev.UUID+"/rootDesc.xml") {
+		t.Errorf("LOCATION %q", got)
+	}
+}
+
+func TestSSDPSearchAllDevices(t *testing.T) {
+	devs := []*device{
+		{UUID: deviceUUID("user1"), User: "user1"},
+		{UUID: deviceUUID("user2"), User: "user2"},
+	}
+	s := fakeSSDP(t, devs...)
+
+	list := search(t, s.conn.LocalAddr(), "ssdp:all")
+	if want := len(devs) * len(devs[0].targets()); len(list) != want {
+		t.Fatalf("got %d responses, want %d", len(list), want)
+	}
+	usns := make(map[string]bool)
+	for _, resp := range list {
+		usns[resp.Header.Get("Usn")] = true
+	}
+	for _, dev := range devs {
+		if !usns["uuid:"+dev.UUID] {
+			t.Errorf("no response for device %s", dev.User)
+		}
+	}
+}
+
+func TestSSDPSearchOtherTarget(t *testing.T) {
+	s := fakeSSDP(t, &device{UUID: deviceUUID("user1"), User: "user1"})
+
+	if list := search(t, s.conn.LocalAddr(), "urn:schemas-upnp-org:device:MediaRenderer:1"); len(list) != 0 {
+		t.Fatalf("got %d responses for renderer search, want 0", len(list))
+	}
+}
+
+func TestDeviceUUID(t *testing.T) {
+	if deviceUUID("user1") != deviceUUID("user1") {
+		t.Error("uuid of user is not stable")
+	}
+	if deviceUUID("user1") == deviceUUID("user2") {
+		t.Error("users have same uuid")
+	}
+	if uuid := deviceUUID(""); len(uuid) != 36 || uuid[14] != '5' {
+		t.Errorf("wrong uuid format %q", uuid)
+	}
+}
@@ -0,0 +1,97 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var binFile = "ffmpeg"
+
+func init() {
+	path, err := exec.LookPath("ffmpeg")
+	if err == nil {
+		binFile = path
+	} else {
+		// working dir
+		if _, err := os.Stat("ffmpeg"); os.IsNotExist(err) {
+			binFile = filepath.Dir(os.Args[0]) + "/ffmpeg"
+		}
+	}
+}
+
+func Exists() bool {
+	_, err := os.Stat(binFile)
+	return !os.IsNotExist(err)
+}
+
+// HLS cuts input to MPEG-TS segments of about segment seconds with growing playlist index.m3u8 in dir,
+// ffmpeg runs until input ends or ctx is done. Without profile streams are copied and segments are cut on
+// keyframes of input, profile encodes video with keyframe on every segment. Audio is number of audio stream
+// of input or "all".
+func HLS(ctx context.Context, input, dir string, segment int, audio string, p *Profile) error {
+	args := []string{"-i", input, "-map", "0:v:0?"}
+	if audio == "all" {
+		args = append(args, "-map", "0:a?")
+	} else {
+		args = append(args, "-map", "0:a:"+audio+"?")
+	}
+	if p == nil {
+		args = append(args, "-c", "copy")
+	} else {
+		args = append(args, p.args()...)
+		args = append(args, "-force_key_frames", "expr:gte(t,n_forced*"+strconv.Itoa(segment)+")")
+	}
+	args = append(args,
+		"-sn",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segment),
+		"-hls_playlist_type", "event",
+		// segment file appears when it is complete
+		"-hls_flags", "temp_file",
+		"-hls_segment_filename", filepath.Join(dir, "%d.ts"),
+		filepath.Join(dir, "index.m3u8"),
+	)
+	return Run(ctx, io.Discard, args...)
+}
+
+// Subtitle converts subtitle stream of input to WebVTT and writes it to w, stream < 0 converts first stream
+// of subtitle file
+func Subtitle(ctx context.Context, input string, stream int, w io.Writer) error {
+	args := []string{"-i", input}
+	if stream >= 0 {
+		args = append(args, "-map", "0:"+strconv.Itoa(stream))
+	}
+	args = append(args, "-c:s", "webvtt", "-f", "webvtt", "pipe:1")
+	return Run(ctx, w, args...)
+}
+
+// Run executes ffmpeg with args writing stdout to w, error contains tail of ffmpeg log
+func Run(ctx context.Context, w io.Writer, args ...string) error {
+	args = append([]string{"-hide_banner", "-loglevel", "error", "-nostdin"}, args...)
+	cmd := exec.CommandContext(ctx, binFile, args...)
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 512 {
+			msg = msg[len(msg)-512:]
+		}
+		return fmt.Errorf("ffmpeg: %w: %s", err, msg)
+	}
+	return nil
+}
+
+func formatSeconds(sec float64) string {
+	return strconv.FormatFloat(sec, 'f', 3, 64)
+}
@@ -0,0 +1,43 @@
+package ffmpeg
+
+import (
+	"context"
+	"io"
+	"strconv"
+)
+
+// Profile of transcoding to H.264 + AAC
+type Profile struct {
+	Height       int    // max video height
+	VideoBitrate string // like 1500k
+	AudioBitrate string
+}
+
+var Profiles = map[string]Profile{
+	"480p":  {Height: 480, VideoBitrate: "1000k", AudioBitrate: "96k"},
+	"720p":  {Height: 720, VideoBitrate: "2500k", AudioBitrate: "128k"},
+	"1080p": {Height: 1080, VideoBitrate: "5000k", AudioBitrate: "192k"},
+}
+
+// Transcode encodes input from start seconds with profile to MPEG-TS and writes it to w,
+// ffmpeg is killed when ctx is done
+func Transcode(ctx context.Context, input string, start float64, p Profile, w io.Writer) error {
+	var args []string
+	if start > 0 {
+		args = append(args, "-ss", formatSeconds(start))
+	}
+	args = append(args, "-i", input, "-map", "0:v:0?", "-map", "0:a:0?")
+	args = append(args, p.args()...)
+	args = append(args, "-f", "mpegts", "pipe:1")
+	return Run(ctx, w, args...)
+}
+
+// args returns encoder options of profile
+func (p *Profile) args() []string {
+	return []string{
+		"-vf", "scale=-2:'min(" + strconv.Itoa(p.Height) + ",ih)'",
+		"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main",
+		"-b:v", p.VideoBitrate, "-maxrate", p.VideoBitrate, "-bufsize", p.VideoBitrate,
+		"-c:a", "aac", "-b:a", p.AudioBitrate, "-ac", "2",
+	}
+}
@@ -24,8 +24,11 @@ require (
         github.com/pkg/errors v0.9.1
         github.com/wlynxg/anet v0.0.5
         go.etcd.io/bbolt v1.4.0
+        golang.org/x/crypto v0.39.0
         golang.org/x/exp v0.0.0-20250606033433-dcc06ee1d476
         golang.org/x/image v0.28.0
+        golang.org/x/net v0.41.0
+        golang.org/x/text v0.26.0
         golang.org/x/time v0.12.0
 )
 
@@ -82,11 +85,8 @@ require (
         github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
         github.com/ugorji/go/codec v1.3.0 // indirect
         golang.org/x/arch v0.18.0 // indirect
-        golang.org/x/crypto v0.39.0 // indirect
-        golang.org/x/net v0.41.0 // indirect
         golang.org/x/sync v0.15.0 // indirect
         golang.org/x/sys v0.33.0 // indirect
-        golang.org/x/text v0.26.0 // indirect
         golang.org/x/tools v0.34.0 // indirect
         gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/agnivade/levenshtein"
@@ -24,6 +25,7 @@ import (
 
 var (
 	torrs  []*models.TorrentDetails
+	muDB   sync.RWMutex // guards torrs and search index, they are replaced together
 	isStop bool
 )
 
@@ -49,8 +51,10 @@ func Start() {
 
 func Stop() {
 	isStop = true
+	muDB.Lock()
 	torrs = nil
 	torrsearch.NewIndex(nil)
+	muDB.Unlock()
 	utils2.FreeOSMemGC()
 	time.Sleep(time.Millisecond * 1500)
 }
@@ -133,11 +137,14 @@ func loadDB() {
 				ftorrs = append(ftorrs, torr)
 			}
 		}
-		torrs = ftorrs
 		log.TLogln("Index rutor db")
+		muDB.Lock()
+		torrs = ftorrs
 		torrsearch.NewIndex(torrs)
-		log.TLogln("Torrents count:", len(torrs))
-		log.TLogln("Indexed words:", len(torrsearch.GetIDX()))
+		muDB.Unlock()
+		torrents, words := Count()
+		log.TLogln("Torrents count:", torrents)
+		log.TLogln("Indexed words:", words)
 
 	} else {
 		log.TLogln("Error load rutor db:", err)
@@ -145,18 +152,27 @@ func loadDB() {
 	utils2.FreeOSMemGC()
 }
 
+// Count returns count of torrents and indexed words in rutor db
+func Count() (torrents int, words int) {
+	muDB.RLock()
+	defer muDB.RUnlock()
+	return len(torrs), len(torrsearch.GetIDX())
+}
+
 func Search(query string) []*models.TorrentDetails {
 	if !settings.BTsets.EnableRutorSearch {
 		return nil
 	}
+	muDB.RLock()
 	matchedIDs := torrsearch.Search(query)
-	if len(matchedIDs) == 0 {
-		return nil
-	}
 	var list []*models.TorrentDetails
 	for _, id := range matchedIDs {
 		list = append(list, torrs[id])
 	}
+	muDB.RUnlock()
+	if len(list) == 0 {
+		return nil
+	}
 
 	hash := utils.ClearStr(query)
 
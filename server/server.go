@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"server/log"
 	"server/settings"
@@ -133,7 +134,13 @@ func WaitServer() string {
 	return ""
 }
 
+var stopOnce sync.Once
+
+// Stop gracefully stops web and torrent servers and closes DB, safe to call many times
 func Stop() {
-	web.Stop()
-	settings.CloseDB()
+	stopOnce.Do(func() {
+		web.Stop()
+		log.TLogln("Close DB")
+		settings.CloseDB()
+	})
 }
@@ -0,0 +1,117 @@
+package settings
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"server/log"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account of http auth user, password is bcrypt/argon2id hash or plain text
+type Account struct {
+	Password string `json:"password"`
+	Role     string `json:"role,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+func (a *Account) IsAdmin() bool {
+	return a != nil && a.Role == RoleAdmin
+}
+
+// ListAccounts returns accounts stored in settings db
+func ListAccounts() map[string]*Account {
+	ret := make(map[string]*Account)
+	for _, user := range tdb.List("Accounts") {
+		if acc := GetAccount(user); acc != nil {
+			ret[user] = acc
+		}
+	}
+	return ret
+}
+
+func GetAccount(user string) *Account {
+	buf := tdb.Get("Accounts", user)
+	if len(buf) == 0 {
+		return nil
+	}
+	acc := new(Account)
+	if err := json.Unmarshal(buf, acc); err != nil {
+		log.TLogln("Error unmarshal account", user, err)
+		return nil
+	}
+	return acc
+}
+
+func SetAccount(user string, acc *Account) {
+	if ReadOnly {
+		log.TLogln("SetAccount: Read-only DB mode!", user)
+		return
+	}
+	if acc.Role == "" {
+		acc.Role = RoleUser
+	}
+	buf, err := json.Marshal(acc)
+	if err != nil {
+		log.TLogln("Error marshal account", user, err)
+		return
+	}
+	tdb.Set("Accounts", user, buf)
+}
+
+func RemAccount(user string) {
+	if ReadOnly {
+		log.TLogln("RemAccount: Read-only DB mode!", user)
+		return
+	}
+	tdb.Rem("Accounts", user)
+}
+
+var (
+	tokenSecret   []byte
+	muTokenSecret sync.Mutex
+)
+
+// TokenSecret returns key for signing stream links, generated on first use and stored in settings db
+func TokenSecret() []byte {
+	muTokenSecret.Lock()
+	defer muTokenSecret.Unlock()
+	if tokenSecret != nil {
+		return tokenSecret
+	}
+	var stored struct {
+		Secret string
+	}
+	if buf := tdb.Get("Settings", "Auth"); len(buf) > 0 {
+		if err := json.Unmarshal(buf, &stored); err != nil {
+			log.TLogln("Error unmarshal auth settings", err)
+		}
+	}
+	if secret, err := hex.DecodeString(stored.Secret); err == nil && len(secret) >= 32 {
+		tokenSecret = secret
+		return tokenSecret
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.TLogln("Error generate token secret", err)
+	}
+	tokenSecret = secret
+	if ReadOnly {
+		log.TLogln("TokenSecret: Read-only DB mode, stream links are valid until restart")
+		return tokenSecret
+	}
+	stored.Secret = hex.EncodeToString(secret)
+	buf, err := json.Marshal(stored)
+	if err != nil {
+		log.TLogln("Error marshal auth settings", err)
+		return tokenSecret
+	}
+	tdb.Set("Settings", "Auth", buf)
+	return tokenSecret
+}
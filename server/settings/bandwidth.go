@@ -0,0 +1,94 @@
+package settings
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"server/log"
+)
+
+// BandwidthRule replaces DownloadRateLimit and UploadRateLimit from Start to End local time
+type BandwidthRule struct {
+	Start             string         // "HH:MM"
+	End               string         // "HH:MM", rule crosses midnight if End is before Start, whole day if equal
+	Days              []time.Weekday // days of Start, 0 - Sunday, empty - every day
+	DownloadRateLimit int            // in kb, 0 - inf
+	UploadRateLimit   int            // in kb, 0 - inf
+}
+
+// parseClock returns minutes since midnight of "HH:MM"
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("wrong time %q: %w", s, err)
+	}
+	if h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("wrong time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func (r *BandwidthRule) check() error {
+	if _, err := parseClock(r.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(r.End); err != nil {
+		return err
+	}
+	for _, d := range r.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return fmt.Errorf("wrong week day %d", d)
+		}
+	}
+	return nil
+}
+
+// Match returns true if rule is active at t
+func (r *BandwidthRule) Match(t time.Time) bool {
+	start, err := parseClock(r.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(r.End)
+	if err != nil {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case start == end:
+	case start < end:
+		if now < start || now >= end {
+			return false
+		}
+	case now >= start:
+	case now < end:
+		// after midnight, rule was started yesterday
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return len(r.Days) == 0 || slices.Contains(r.Days, day)
+}
+
+// RateLimits returns rate limits in kb at t, first matching rule of BandwidthSchedule overrides static limits
+func (v *BTSets) RateLimits(t time.Time) (download, upload int) {
+	for i := range v.BandwidthSchedule {
+		if r := &v.BandwidthSchedule[i]; r.Match(t) {
+			return r.DownloadRateLimit, r.UploadRateLimit
+		}
+	}
+	return v.DownloadRateLimit, v.UploadRateLimit
+}
+
+// checkSchedule drops wrong rules of schedule
+func checkSchedule(schedule []BandwidthRule) []BandwidthRule {
+	return slices.DeleteFunc(schedule, func(r BandwidthRule) bool {
+		if err := r.check(); err != nil {
+			log.TLogln("Drop bandwidth rule", r.Start, r.End, err)
+			return true
+		}
+		return false
+	})
+}
@@ -0,0 +1,66 @@
+package settings
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBandwidthRuleMatch(t *testing.T) {
+	// 2024-01-05 is Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local)
+	}
+	work := BandwidthRule{Start: "09:00", End: "18:00", Days: []time.Weekday{time.Monday, time.Friday}}
+	night := BandwidthRule{Start: "23:30", End: "07:00", Days: []time.Weekday{time.Friday}}
+	tests := []struct {
+		rule BandwidthRule
+		t    time.Time
+		want bool
+	}{
+		{work, at(5, 9, 0), true},
+		{work, at(5, 17, 59), true},
+		{work, at(5, 18, 0), false},
+		{work, at(5, 8, 59), false},
+		{work, at(6, 12, 0), false}, // Saturday
+		{night, at(5, 23, 30), true},
+		{night, at(6, 6, 59), true}, // started on Friday
+		{night, at(6, 7, 0), false},
+		{night, at(5, 6, 0), false}, // started on Thursday
+		{night, at(6, 23, 45), false},
+		{BandwidthRule{Start: "00:00", End: "00:00"}, at(7, 15, 0), true},
+		{BandwidthRule{Start: "25:00", End: "07:00"}, at(5, 3, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Match(tt.t); got != tt.want {
+			t.Errorf("%s-%s %v at %s = %v, want %v", tt.rule.Start, tt.rule.End, tt.rule.Days, tt.t.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	sets := &BTSets{
+		DownloadRateLimit: 1000,
+		UploadRateLimit:   100,
+		BandwidthSchedule: checkSchedule([]BandwidthRule{
+			{Start: "9:00", End: "18:00", DownloadRateLimit: 500, UploadRateLimit: 50},
+			{Start: "bad", End: "18:00"},
+			{Start: "00:00", End: "12:00"},
+		}),
+	}
+	if len(sets.BandwidthSchedule) != 2 {
+		t.Fatalf("wrong rule is not dropped %v", sets.BandwidthSchedule)
+	}
+	for _, tt := range []struct {
+		hour     int
+		down, up int
+	}{
+		{10, 500, 50}, // first matching rule wins
+		{8, 0, 0},
+		{20, 1000, 100},
+	} {
+		down, up := sets.RateLimits(time.Date(2024, 1, 5, tt.hour, 0, 0, 0, time.Local))
+		if down != tt.down || up != tt.up {
+			t.Errorf("at %d:00 limits %d/%d, want %d/%d", tt.hour, down, up, tt.down, tt.up)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/fs"
 	"path/filepath"
+	"reflect"
 	"strings"
 
 	"server/log"
@@ -15,21 +16,31 @@ type BTSets struct {
 	CacheSize       int64 // in byte, def 64 MB
 	ReaderReadAHead int   // in percent, 5%-100%, [...S__X__E...] [S-E] not clean
 	PreloadCache    int   // in percent
+	SharedCache     bool  // share cache of same torrent between users
 
 	// Disk
 	UseDisk           bool
 	TorrentsSavePath  string
 	RemoveCacheOnDrop bool
+	DiskCacheSize     int64  // in byte, budget of disk cache of all torrents, 0 - unlimited
+	VerifyDiskCache   bool   // check hashes of pieces restored from disk cache on torrent open
+	DownloadPath      string // directory of fully downloaded files, download mode is disabled if empty
 
 	// Torrent
 	ForceEncrypt             bool
 	RetrackersMode           int  // 0 - don`t add, 1 - add retrackers (def), 2 - remove retrackers 3 - replace retrackers
 	TorrentDisconnectTimeout int  // in seconds
+	ServerIdleTimeout        int  // in minutes, disconnect torrent server of idle user, def 15
+	ServerPinned             bool // never disconnect idle torrent server
 	EnableDebug              bool // debug logs
 
 	// Rutor
 	EnableRutorSearch bool
 
+	// DLNA
+	EnableDLNA   bool
+	FriendlyName string // name of DLNA server, account name is appended for each user
+
 	// BT Config
 	EnableIPv6        bool
 	DisableTCP        bool
@@ -38,8 +49,9 @@ type BTSets struct {
 	DisableDHT        bool
 	DisablePEX        bool
 	DisableUpload     bool
-	DownloadRateLimit int // in kb, 0 - inf
-	UploadRateLimit   int // in kb, 0 - inf
+	DownloadRateLimit int             // in kb, 0 - inf
+	UploadRateLimit   int             // in kb, 0 - inf
+	BandwidthSchedule []BandwidthRule // time of day rate limits, applied without restart
 	ConnectionsLimit  int
 	PeersListenPort   int
 
@@ -50,6 +62,9 @@ type BTSets struct {
 
 	// Reader
 	ResponsiveMode bool // enable Responsive reader (don't wait pieceComplete)
+
+	// Auth
+	StreamTokenTTL int // in hours, lifetime of signed stream links, def 168
 }
 
 func (v *BTSets) String() string {
@@ -59,11 +74,27 @@ func (v *BTSets) String() string {
 
 var BTsets *BTSets
 
-func SetBTSets(sets *BTSets) {
-	if ReadOnly {
-		return
+// SetsChange is old and new value of changed setting
+type SetsChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// DiffBTSets returns changed fields of settings by field name
+func DiffBTSets(old, cur *BTSets) map[string]SetsChange {
+	diff := make(map[string]SetsChange)
+	a, b := reflect.ValueOf(old).Elem(), reflect.ValueOf(cur).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		x, y := a.Field(i).Interface(), b.Field(i).Interface()
+		if !reflect.DeepEqual(x, y) {
+			diff[a.Type().Field(i).Name] = SetsChange{Old: x, New: y}
+		}
 	}
-	// failsafe checks (use defaults)
+	return diff
+}
+
+// checkBTSets applies failsafe checks to sets, wrong values are replaced by defaults or clamped
+func checkBTSets(sets *BTSets) {
 	if sets.CacheSize == 0 {
 		sets.CacheSize = 64 * 1024 * 1024
 	}
@@ -73,6 +104,12 @@ func SetBTSets(sets *BTSets) {
 	if sets.TorrentDisconnectTimeout == 0 {
 		sets.TorrentDisconnectTimeout = 30
 	}
+	if sets.ServerIdleTimeout <= 0 {
+		sets.ServerIdleTimeout = 15
+	}
+	if sets.StreamTokenTTL <= 0 {
+		sets.StreamTokenTTL = 168
+	}
 
 	if sets.ReaderReadAHead < 5 {
 		sets.ReaderReadAHead = 5
@@ -88,9 +125,24 @@ func SetBTSets(sets *BTSets) {
 		sets.PreloadCache = 100
 	}
 
+	if sets.DiskCacheSize < 0 {
+		sets.DiskCacheSize = 0
+	}
+	sets.BandwidthSchedule = checkSchedule(sets.BandwidthSchedule)
+
 	if sets.TorrentsSavePath == "" {
 		sets.UseDisk = false
-	} else if sets.UseDisk {
+	}
+}
+
+func SetBTSets(sets *BTSets) {
+	if ReadOnly {
+		return
+	}
+	// failsafe checks (use defaults)
+	checkBTSets(sets)
+
+	if sets.UseDisk {
 		BTsets = sets
 
 		go filepath.WalkDir(sets.TorrentsSavePath, func(path string, d fs.DirEntry, err error) error {
@@ -125,7 +177,9 @@ func SetDefaultConfig() {
 	sets.ConnectionsLimit = 25
 	sets.RetrackersMode = 1
 	sets.TorrentDisconnectTimeout = 30
+	sets.ServerIdleTimeout = 15
 	sets.ReaderReadAHead = 95 // 95%
+	sets.StreamTokenTTL = 168 // 7 days
 	BTsets = sets
 	if !ReadOnly {
 		buf, err := json.Marshal(BTsets)
@@ -142,9 +196,7 @@ func loadBTSets() {
 	if len(buf) > 0 {
 		err := json.Unmarshal(buf, &BTsets)
 		if err == nil {
-			if BTsets.ReaderReadAHead < 5 {
-				BTsets.ReaderReadAHead = 5
-			}
+			checkBTSets(BTsets)
 			return
 		}
 		log.TLogln("Error unmarshal btsets", err)
@@ -0,0 +1,34 @@
+package settings
+
+import "testing"
+
+func TestDiffBTSets(t *testing.T) {
+	old := &BTSets{
+		CacheSize:                64 << 20,
+		ReaderReadAHead:          95,
+		PreloadCache:             50,
+		ConnectionsLimit:         25,
+		TorrentDisconnectTimeout: 30,
+		ServerIdleTimeout:        15,
+		StreamTokenTTL:           168,
+	}
+	cur := *old
+	cur.ReaderReadAHead = 200
+	cur.PreloadCache = -1
+	cur.UseDisk = true // no TorrentsSavePath
+	checkBTSets(&cur)
+
+	diff := DiffBTSets(old, &cur)
+	want := map[string]SetsChange{
+		"ReaderReadAHead": {Old: 95, New: 100},
+		"PreloadCache":    {Old: 50, New: 0},
+	}
+	if len(diff) != len(want) {
+		t.Fatalf("diff %v, want %v", diff, want)
+	}
+	for name, ch := range want {
+		if diff[name] != ch {
+			t.Errorf("%s changed %v, want %v", name, diff[name], ch)
+		}
+	}
+}
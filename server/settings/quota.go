@@ -0,0 +1,70 @@
+package settings
+
+import (
+	"encoding/json"
+
+	"server/log"
+)
+
+// DefaultQuota is the quota name applied to users without own quota
+const DefaultQuota = "*"
+
+// UserQuota limits resources of one user torrent server.
+// Zero value means unlimited, negative MaxTorrents / MaxReaders / MaxTranscodes forbid the resource.
+type UserQuota struct {
+	MaxTorrents       int   // active torrents in client
+	MaxReaders        int   // concurrent stream readers
+	MaxTranscodes     int   // concurrent ffmpeg transcodes
+	CacheSize         int64 // in byte, caps CacheSize for user torrents
+	DownloadRateLimit int   // in kb, caps DownloadRateLimit
+	UploadRateLimit   int   // in kb, caps UploadRateLimit
+}
+
+func (v *UserQuota) String() string {
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
+
+// GetUserQuota returns quota of user, default quota or empty (unlimited) quota
+func GetUserQuota(user string) *UserQuota {
+	for _, name := range []string{normalizeUserID(user), DefaultQuota} {
+		buf := tdb.Get("Quotas", name)
+		if len(buf) == 0 {
+			continue
+		}
+		quota := new(UserQuota)
+		if err := json.Unmarshal(buf, quota); err != nil {
+			log.TLogln("Error unmarshal quota", name, err)
+			continue
+		}
+		return quota
+	}
+	return new(UserQuota)
+}
+
+func SetUserQuota(user string, quota *UserQuota) {
+	if ReadOnly {
+		return
+	}
+	name := user
+	if name != DefaultQuota {
+		name = normalizeUserID(user)
+	}
+	buf, err := json.Marshal(quota)
+	if err != nil {
+		log.TLogln("Error marshal quota", name, err)
+		return
+	}
+	tdb.Set("Quotas", name, buf)
+}
+
+func RemUserQuota(user string) {
+	if ReadOnly {
+		return
+	}
+	name := user
+	if name != DefaultQuota {
+		name = normalizeUserID(user)
+	}
+	tdb.Rem("Quotas", name)
+}
@@ -3,6 +3,7 @@ package settings
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"server/log"
 )
@@ -21,6 +22,8 @@ var (
 	PubIPv6  string
 	TorAddr  string
 	MaxSize  int64
+
+	ShutdownTimeout = 30 * time.Second // wait active streams on shutdown
 )
 
 func InitSets(readOnly, searchWA bool) {
@@ -43,6 +46,9 @@ func InitSets(readOnly, searchWA bool) {
 	// First registered DB becomes default route
 	dbRouter.RegisterRoute(jsonDB, "Settings")
 	dbRouter.RegisterRoute(jsonDB, "Viewed")
+	dbRouter.RegisterRoute(jsonDB, "ViewedTime")
+	dbRouter.RegisterRoute(jsonDB, "Quotas")
+	dbRouter.RegisterRoute(jsonDB, "Accounts")
 	dbRouter.RegisterRoute(bboltDB, "Torrents")
 
 	tdb = NewDBReadCache(dbRouter)
@@ -17,6 +17,11 @@ type TorrentDB struct {
 	Poster   string `json:"poster,omitempty"`
 	Data     string `json:"data,omitempty"`
 
+	// Media is ffprobe summary by file path, it is decoded by torr
+	Media json.RawMessage `json:"media,omitempty"`
+	// Download is ids of files saved to DownloadPath, empty not nil list clears it
+	Download []int `json:"download,omitempty"`
+
 	Timestamp int64 `json:"timestamp,omitempty"`
 	Size      int64 `json:"size,omitempty"`
 }
@@ -44,6 +49,12 @@ func AddTorrent(user string, torr *TorrentDB) {
 		}
 	}
 	if find != -1 {
+		if torr.Media == nil {
+			torr.Media = list[find].Media
+		}
+		if torr.Download == nil {
+			torr.Download = list[find].Download
+		}
 		list[find] = torr
 	} else {
 		list = append(list, torr)
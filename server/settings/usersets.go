@@ -0,0 +1,113 @@
+package settings
+
+import (
+	"encoding/json"
+
+	"server/log"
+)
+
+// UserBTSets overrides global BTSets for one user, nil field keeps global value.
+// DLNA has no global value, library of account is shown to DLNA clients only when it is true.
+type UserBTSets struct {
+	CacheSize         *int64 // in byte
+	ConnectionsLimit  *int
+	DownloadRateLimit *int            // in kb, 0 - inf
+	UploadRateLimit   *int            // in kb, 0 - inf
+	BandwidthSchedule []BandwidthRule // nil - global schedule, empty - no schedule
+	RetrackersMode    *int            // 0 - don`t add, 1 - add retrackers, 2 - remove retrackers 3 - replace retrackers
+	ResponsiveMode    *bool
+	ServerIdleTimeout *int // in minutes
+	ServerPinned      *bool
+	DLNA              *bool
+}
+
+func (v *UserBTSets) String() string {
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
+
+func GetUserBTSets(user string) *UserBTSets {
+	buf := tdb.Get(joinUserXPath("Settings", user), "BitTorr")
+	if len(buf) == 0 {
+		return nil
+	}
+	sets := new(UserBTSets)
+	if err := json.Unmarshal(buf, sets); err != nil {
+		log.TLogln("Error unmarshal user btsets", user, err)
+		return nil
+	}
+	return sets
+}
+
+func SetUserBTSets(user string, sets *UserBTSets) {
+	if ReadOnly {
+		return
+	}
+	// failsafe checks (drop wrong overrides)
+	if sets.CacheSize != nil && *sets.CacheSize <= 0 {
+		sets.CacheSize = nil
+	}
+	if sets.ConnectionsLimit != nil && *sets.ConnectionsLimit <= 0 {
+		sets.ConnectionsLimit = nil
+	}
+	if sets.RetrackersMode != nil && (*sets.RetrackersMode < 0 || *sets.RetrackersMode > 3) {
+		sets.RetrackersMode = nil
+	}
+	if sets.ServerIdleTimeout != nil && *sets.ServerIdleTimeout <= 0 {
+		sets.ServerIdleTimeout = nil
+	}
+	sets.BandwidthSchedule = checkSchedule(sets.BandwidthSchedule)
+	buf, err := json.Marshal(sets)
+	if err != nil {
+		log.TLogln("Error marshal user btsets", user, err)
+		return
+	}
+	tdb.Set(joinUserXPath("Settings", user), "BitTorr", buf)
+}
+
+func RemUserBTSets(user string) {
+	if ReadOnly {
+		return
+	}
+	tdb.Rem(joinUserXPath("Settings", user), "BitTorr")
+}
+
+// GetBTSets returns copy of global BTSets merged with user overrides
+func GetBTSets(user string) *BTSets {
+	sets := *BTsets
+	over := GetUserBTSets(user)
+	if over == nil {
+		return &sets
+	}
+	if over.CacheSize != nil {
+		sets.CacheSize = *over.CacheSize
+	}
+	if over.ConnectionsLimit != nil {
+		sets.ConnectionsLimit = *over.ConnectionsLimit
+	}
+	if over.DownloadRateLimit != nil {
+		sets.DownloadRateLimit = *over.DownloadRateLimit
+	}
+	if over.UploadRateLimit != nil {
+		sets.UploadRateLimit = *over.UploadRateLimit
+	}
+	if over.BandwidthSchedule != nil {
+		sets.BandwidthSchedule = over.BandwidthSchedule
+	} else if over.DownloadRateLimit != nil || over.UploadRateLimit != nil {
+		// own static limits of user are not replaced by global schedule
+		sets.BandwidthSchedule = nil
+	}
+	if over.RetrackersMode != nil {
+		sets.RetrackersMode = *over.RetrackersMode
+	}
+	if over.ResponsiveMode != nil {
+		sets.ResponsiveMode = *over.ResponsiveMode
+	}
+	if over.ServerIdleTimeout != nil {
+		sets.ServerIdleTimeout = *over.ServerIdleTimeout
+	}
+	if over.ServerPinned != nil {
+		sets.ServerPinned = *over.ServerPinned
+	}
+	return &sets
+}
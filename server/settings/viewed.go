@@ -2,6 +2,8 @@ package settings
 
 import (
 	"encoding/json"
+	"strings"
+	"time"
 
 	"server/log"
 )
@@ -36,6 +38,7 @@ func SetViewed(user string, vv *Viewed) {
 	buf, err = json.Marshal(indexes)
 	if err == nil {
 		tdb.Set(path, vv.Hash, buf)
+		setViewedTime(user, vv.Hash, time.Now().Unix())
 	} else {
 		log.TLogln("Error set viewed:", user, err)
 	}
@@ -53,6 +56,7 @@ func RemViewed(user string, vv *Viewed) {
 				delete(entries, vv.FileIndex)
 				if len(entries) == 0 {
 					delete(indeces, userKey)
+					setViewedTime(user, vv.Hash, 0)
 				}
 				if len(indeces) == 0 {
 					tdb.Rem(path, vv.Hash)
@@ -66,6 +70,7 @@ func RemViewed(user string, vv *Viewed) {
 			}
 		} else {
 			delete(indeces, userKey)
+			setViewedTime(user, vv.Hash, 0)
 			if len(indeces) == 0 {
 				tdb.Rem(path, vv.Hash)
 				return
@@ -121,3 +126,47 @@ func ListViewed(hash string, user string) []*Viewed {
 	log.TLogln("Error list viewed:", user, err)
 	return []*Viewed{}
 }
+
+// setViewedTime stores last view time of torrent by user separately from viewed files, 0 removes it
+func setViewedTime(user, hash string, tm int64) {
+	path := "ViewedTime"
+	times := make(map[string]int64)
+	if buf := tdb.Get(path, hash); len(buf) > 0 {
+		if err := json.Unmarshal(buf, &times); err != nil {
+			log.TLogln("Error decode viewed time:", user, err)
+		}
+	}
+	userKey := normalizeUserID(user)
+	if tm > 0 {
+		times[userKey] = tm
+	} else {
+		delete(times, userKey)
+	}
+	if len(times) == 0 {
+		tdb.Rem(path, hash)
+		return
+	}
+	buf, err := json.Marshal(times)
+	if err != nil {
+		log.TLogln("Error set viewed time:", user, err)
+		return
+	}
+	tdb.Set(path, hash, buf)
+}
+
+// LastViewed returns lowercase hashes of torrents with viewed files of user and time of last view in unix seconds,
+// time is 0 for files viewed before times were stored
+func LastViewed(user string) map[string]int64 {
+	userKey := normalizeUserID(user)
+	ret := make(map[string]int64)
+	for _, key := range tdb.List("Viewed") {
+		var indeces map[string]map[int]struct{}
+		if err := json.Unmarshal(tdb.Get("Viewed", key), &indeces); err != nil || len(indeces[userKey]) == 0 {
+			continue
+		}
+		var times map[string]int64
+		json.Unmarshal(tdb.Get("ViewedTime", key), &times)
+		ret[strings.ToLower(key)] = times[userKey]
+	}
+	return ret
+}
@@ -5,6 +5,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"sort"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 
 	"server/log"
 	sets "server/settings"
+	"server/torr/state"
 	"server/web/auth"
 )
 
@@ -43,6 +46,7 @@ func LoadTorrent(user string, tor *Torrent) *Torrent {
 	tr.Title = tor.Title
 	tr.Poster = tor.Poster
 	tr.Data = tor.Data
+	tr.setMedia(tor.mediaCopy())
 	return tr
 }
 
@@ -91,6 +95,10 @@ func AddTorrent(user string, spec *torrent.TorrentSpec, title, poster string, da
 		}
 	}
 
+	if torDB != nil && torr.mediaCopy() == nil {
+		torr.setMedia(torDB.mediaCopy())
+	}
+
 	return torr, nil
 }
 
@@ -130,7 +138,10 @@ func GetTorrent(user, hashHex string) *Torrent {
 		tor = tr
 		go func() {
 			log.TLogln("New torrent", user, tor.Hash())
-			tr, _ := NewTorrent(tor.TorrentSpec, bt)
+			tr, err := NewTorrent(tor.TorrentSpec, bt)
+			if err != nil {
+				log.TLogln("error load torrent:", user, err)
+			}
 			if tr != nil {
 				tr.Title = tor.Title
 				tr.Poster = tor.Poster
@@ -138,6 +149,7 @@ func GetTorrent(user, hashHex string) *Torrent {
 				tr.Size = tor.Size
 				tr.Timestamp = tor.Timestamp
 				tr.Category = tor.Category
+				tr.setMedia(tor.mediaCopy())
 				tr.GotInfo()
 			}
 		}()
@@ -288,22 +300,94 @@ func DropTorrent(user, hashHex string) {
 	bt.RemoveTorrent(hash)
 }
 
-func SetSettings(set *sets.BTSets) {
+// Results of settings change
+const (
+	ApplyLive    = "live"    // settings are changed in running servers
+	ApplyRestart = "restart" // servers are reconnected, their torrents are dropped
+)
+
+// SetSettings stores settings and applies them, see applySettings
+func SetSettings(set *sets.BTSets) string {
 	if sets.ReadOnly {
 		log.TLogln("API SetSettings: Read-only DB mode!")
-		return
+		return ""
+	}
+	return applySettings(func() {
+		sets.SetBTSets(set)
+	})
+}
+
+// SetUserSettings stores user overrides of BTSets (nil removes them) and applies them to user server
+func SetUserSettings(user string, set *sets.UserBTSets) string {
+	if sets.ReadOnly {
+		log.TLogln("API SetUserSettings: Read-only DB mode!", user)
+		return ""
 	}
-	sets.SetBTSets(set)
-	restartServers()
+	return applySettings(func() {
+		if set == nil {
+			sets.RemUserBTSets(user)
+		} else {
+			sets.SetUserBTSets(user, set)
+		}
+	}, normalizeUser(user))
+}
+
+// SetUserQuota stores user quota (nil removes it) and applies cache and rate caps to user server
+func SetUserQuota(user string, quota *sets.UserQuota) string {
+	if sets.ReadOnly {
+		log.TLogln("API SetUserQuota: Read-only DB mode!", user)
+		return ""
+	}
+	store := func() {
+		if quota == nil {
+			sets.RemUserQuota(user)
+		} else {
+			sets.SetUserQuota(user, quota)
+		}
+	}
+	if user == sets.DefaultQuota {
+		return applySettings(store)
+	}
+	return applySettings(store, normalizeUser(user))
 }
 
-func SetDefSettings() {
+func SetDefSettings() string {
 	if sets.ReadOnly {
 		log.TLogln("API SetDefSettings: Read-only DB mode!")
-		return
+		return ""
 	}
-	sets.SetDefaultConfig()
-	restartServers()
+	return applySettings(sets.SetDefaultConfig)
+}
+
+// applySettings calls store and restarts servers of users whose clientSets are changed,
+// other servers get new settings in place. Without users all servers are checked.
+func applySettings(store func(), users ...string) string {
+	old := make(map[string]*sets.BTSets)
+	forServers(users, func(user string, bt *BTServer) {
+		old[user], _ = effectiveSets(user)
+	})
+	store()
+
+	var restart []string
+	forServers(users, func(user string, bt *BTServer) {
+		cur, _ := effectiveSets(user)
+		if needRestart(old[user], cur) {
+			restart = append(restart, user)
+			return
+		}
+		bt.applySettings()
+	})
+	if len(restart) == 0 {
+		log.TLogln("apply settings without restart", users)
+		return ApplyLive
+	}
+	restartServers(restart...)
+	return ApplyRestart
+}
+
+// needRestart reports whether change of settings can't be applied to running server
+func needRestart(old, cur *sets.BTSets) bool {
+	return old == nil || !reflect.DeepEqual(clientSets(old), clientSets(cur))
 }
 
 func dropAllTorrent(bt *BTServer) {
@@ -313,18 +397,28 @@ func dropAllTorrent(bt *BTServer) {
 	}
 }
 
-func restartServers() {
-	log.TLogln("drop all torrents")
+// forServers calls fn for running servers of given users or for all servers if no users set
+func forServers(users []string, fn func(string, *BTServer)) {
 	ForEachServer(func(user string, bt *BTServer) {
+		if len(users) == 0 || slices.Contains(users, user) {
+			fn(user, bt)
+		}
+	})
+}
+
+// restartServers reconnects servers of given users or all servers if no users set
+func restartServers(users ...string) {
+	log.TLogln("drop all torrents", users)
+	forServers(users, func(user string, bt *BTServer) {
 		dropAllTorrent(bt)
 	})
 	time.Sleep(time.Second * 1)
 	log.TLogln("disconect")
-	ForEachServer(func(user string, bt *BTServer) {
+	forServers(users, func(user string, bt *BTServer) {
 		bt.Disconnect()
 	})
 	log.TLogln("connect")
-	ForEachServer(func(user string, bt *BTServer) {
+	forServers(users, func(user string, bt *BTServer) {
 		if _, err := ConnectServer(user); err != nil {
 			log.TLogln("error reconnect torrent server", user, err)
 		}
@@ -333,6 +427,36 @@ func restartServers() {
 	log.TLogln("end set settings")
 }
 
+// ListServersStatus returns status of all running torrent servers and of not running servers of users sorted by user
+func ListServersStatus(users ...string) []*state.ServerStatus {
+	var ret []*state.ServerStatus
+	running := make(map[string]bool)
+	ForEachServer(func(user string, bt *BTServer) {
+		ret = append(ret, bt.Status())
+		running[user] = true
+	})
+	for _, user := range users {
+		if running[normalizeUser(user)] {
+			continue
+		}
+		btsets := sets.GetBTSets(user)
+		st := &state.ServerStatus{
+			User:        normalizeUser(user),
+			IdleTimeout: int(idleTimeout(btsets.ServerIdleTimeout) / time.Minute),
+			Pinned:      btsets.ServerPinned,
+			Torrents:    []*state.TorrentStatus{},
+		}
+		serversMu.Lock()
+		fillEvictions(st)
+		serversMu.Unlock()
+		ret = append(ret, st)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].User < ret[j].User
+	})
+	return ret
+}
+
 func WriteStatus(user string, w io.Writer) {
 	bt := getServer(user)
 	if bt == nil || bt.client == nil {
@@ -342,14 +466,15 @@ func WriteStatus(user string, w io.Writer) {
 }
 
 func Preload(torr *Torrent, index int) {
-	cache := float32(sets.BTsets.CacheSize)
-	preload := float32(sets.BTsets.PreloadCache)
+	btsets := torr.bt.Settings()
+	cache := float32(btsets.CacheSize)
+	preload := float32(btsets.PreloadCache)
 	size := int64((cache / 100.0) * preload)
 	if size <= 0 {
 		return
 	}
-	if size > sets.BTsets.CacheSize {
-		size = sets.BTsets.CacheSize
+	if size > btsets.CacheSize {
+		size = btsets.CacheSize
 	}
 	torr.Preload(index, size)
 }
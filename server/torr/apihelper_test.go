@@ -0,0 +1,48 @@
+package torr
+
+import (
+	"testing"
+
+	"server/settings"
+)
+
+func TestNeedRestart(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*settings.BTSets)
+		restart bool
+	}{
+		{"nothing", func(s *settings.BTSets) {}, false},
+		{"CacheSize", func(s *settings.BTSets) { s.CacheSize = 128 << 20 }, true},
+		{"SharedCache", func(s *settings.BTSets) { s.SharedCache = true }, true},
+		{"UseDisk", func(s *settings.BTSets) { s.UseDisk = true }, true},
+		{"TorrentsSavePath", func(s *settings.BTSets) { s.TorrentsSavePath = "/tmp" }, true},
+		{"ForceEncrypt", func(s *settings.BTSets) { s.ForceEncrypt = true }, true},
+		{"DisableDHT", func(s *settings.BTSets) { s.DisableDHT = true }, true},
+		{"DisableUpload", func(s *settings.BTSets) { s.DisableUpload = true }, true},
+		{"ConnectionsLimit", func(s *settings.BTSets) { s.ConnectionsLimit = 50 }, true},
+		{"PeersListenPort", func(s *settings.BTSets) { s.PeersListenPort = 6881 }, true},
+		{"DownloadRateLimit", func(s *settings.BTSets) { s.DownloadRateLimit = 1000 }, false},
+		{"BandwidthSchedule", func(s *settings.BTSets) {
+			s.BandwidthSchedule = []settings.BandwidthRule{{Start: "08:00", End: "20:00", DownloadRateLimit: 100}}
+		}, false},
+		{"ReaderReadAHead", func(s *settings.BTSets) { s.ReaderReadAHead = 50 }, false},
+		{"PreloadCache", func(s *settings.BTSets) { s.PreloadCache = 10 }, false},
+		{"RetrackersMode", func(s *settings.BTSets) { s.RetrackersMode = 2 }, false},
+		{"ResponsiveMode", func(s *settings.BTSets) { s.ResponsiveMode = true }, false},
+		{"EnableDebug", func(s *settings.BTSets) { s.EnableDebug = true }, false},
+		{"ServerIdleTimeout", func(s *settings.BTSets) { s.ServerIdleTimeout = 30 }, false},
+		{"DiskCacheSize", func(s *settings.BTSets) { s.DiskCacheSize = 1 << 30 }, false},
+	}
+	old := &settings.BTSets{CacheSize: 64 << 20, ConnectionsLimit: 25, ReaderReadAHead: 95, ServerIdleTimeout: 15}
+	for _, tt := range tests {
+		cur := *old
+		tt.change(&cur)
+		if got := needRestart(old, &cur); got != tt.restart {
+			t.Errorf("%s: restart %v, want %v", tt.name, got, tt.restart)
+		}
+	}
+	if !needRestart(nil, old) {
+		t.Error("server without previous settings is not restarted")
+	}
+}
@@ -0,0 +1,41 @@
+package torr
+
+import (
+	"time"
+
+	"server/log"
+	"server/settings"
+	"server/torr/utils"
+)
+
+// rateLimits returns rate limits of server user at now in kb, scheduled limits are capped by quota
+func (bt *BTServer) rateLimits(now time.Time) (download, upload int) {
+	quota := userQuota(bt.user)
+	download, upload = settings.GetBTSets(bt.user).RateLimits(now)
+	return minLimit(download, quota.DownloadRateLimit), minLimit(upload, quota.UploadRateLimit)
+}
+
+// updateRateLimits changes limiters of connected client to current rate limits
+func (bt *BTServer) updateRateLimits(now time.Time) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if bt.client == nil || bt.config == nil {
+		return
+	}
+	download, upload := bt.rateLimits(now)
+	if download == bt.downloadLimit && upload == bt.uploadLimit {
+		return
+	}
+	log.TLogln("Set rate limits", normalizeUser(bt.user), "download", download, "upload", upload)
+	utils.SetLimit(bt.config.DownloadRateLimiter, download*1024)
+	utils.SetLimit(bt.config.UploadRateLimiter, upload*1024)
+	bt.downloadLimit, bt.uploadLimit = download, upload
+}
+
+// updateRateLimits applies rate limits of settings and bandwidth schedules to all servers
+func updateRateLimits() {
+	now := time.Now()
+	ForEachServer(func(_ string, bt *BTServer) {
+		bt.updateRateLimits(now)
+	})
+}
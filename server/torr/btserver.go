@@ -6,7 +6,9 @@ import (
 	"log"
 	"maps"
 	"net"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/publicip"
@@ -15,6 +17,7 @@ import (
 	"github.com/wlynxg/anet"
 
 	"server/settings"
+	"server/torr/state"
 	"server/torr/storage/torrstor"
 	"server/torr/utils"
 	"server/version"
@@ -25,11 +28,22 @@ type BTServer struct {
 	client *torrent.Client
 
 	storage *torrstor.Storage
+	sets    atomic.Pointer[settings.BTSets] // replaced by applySettings, read without locks
 
 	torrents map[metainfo.Hash]*Torrent
 
+	user     string
 	mu       sync.Mutex
 	lastUsed time.Time
+
+	streams      atomic.Int64 // active http streams
+	streamsTotal atomic.Int64
+
+	transcodes   int
+	muTranscodes sync.Mutex
+
+	downloadLimit int // current rate limits in kb, 0 - inf
+	uploadLimit   int
 }
 
 var privateIPBlocks []*net.IPNet
@@ -83,7 +97,10 @@ func (bt *BTServer) configure(ctx context.Context) {
 	blocklist, _ := utils.ReadBlockedIP()
 	bt.config = torrent.NewDefaultClientConfig()
 
-	bt.storage = torrstor.NewStorage(settings.BTsets.CacheSize)
+	sets, quota := effectiveSets(bt.user)
+	bt.sets.Store(sets)
+
+	bt.storage = torrstor.NewStorage(sets.CacheSize, sets.SharedCache)
 	bt.config.DefaultStorage = bt.storage
 
 	userAgent := "qBittorrent/4.3.9"
@@ -91,53 +108,52 @@ func (bt *BTServer) configure(ctx context.Context) {
 	upnpID := "TorrServer/" + version.Version
 	cliVers := userAgent
 
-	bt.config.Debug = settings.BTsets.EnableDebug
-	bt.config.DisableIPv6 = !settings.BTsets.EnableIPv6
-	bt.config.DisableTCP = settings.BTsets.DisableTCP
-	bt.config.DisableUTP = settings.BTsets.DisableUTP
+	bt.config.Debug = sets.EnableDebug
+	bt.config.DisableIPv6 = !sets.EnableIPv6
+	bt.config.DisableTCP = sets.DisableTCP
+	bt.config.DisableUTP = sets.DisableUTP
 	//	https://github.com/anacrolix/torrent/issues/703
 	// bt.config.DisableWebtorrent = true //	NE
 	// bt.config.DisableWebseeds = false  //	NE
-	bt.config.NoDefaultPortForwarding = settings.BTsets.DisableUPNP
-	bt.config.NoDHT = settings.BTsets.DisableDHT
-	bt.config.DisablePEX = settings.BTsets.DisablePEX
-	bt.config.NoUpload = settings.BTsets.DisableUpload
+	bt.config.NoDefaultPortForwarding = sets.DisableUPNP
+	bt.config.NoDHT = sets.DisableDHT
+	bt.config.DisablePEX = sets.DisablePEX
+	bt.config.NoUpload = sets.DisableUpload
 	bt.config.IPBlocklist = blocklist
 	bt.config.Bep20 = peerID
 	bt.config.PeerID = utils.PeerIDRandom(peerID)
 	bt.config.UpnpID = upnpID
 	bt.config.HTTPUserAgent = userAgent
 	bt.config.ExtendedHandshakeClientVersion = cliVers
-	bt.config.EstablishedConnsPerTorrent = settings.BTsets.ConnectionsLimit
+	bt.config.EstablishedConnsPerTorrent = sets.ConnectionsLimit
 	bt.config.TotalHalfOpenConns = 500
 	// Encryption/Obfuscation
 	bt.config.EncryptionPolicy = torrent.EncryptionPolicy{ //	OE
-		ForceEncryption: settings.BTsets.ForceEncrypt, //	OE
+		ForceEncryption: sets.ForceEncrypt, //	OE
 	} //	OE
 	// bt.config.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{ //	NE
-	// 	RequirePreferred: settings.BTsets.ForceEncrypt, //	NE
+	// 	RequirePreferred: sets.ForceEncrypt, //	NE
 	// 	Preferred:        true,                         //	NE
 	// } //	NE
-	if settings.BTsets.DownloadRateLimit > 0 {
-		bt.config.DownloadRateLimiter = utils.Limit(settings.BTsets.DownloadRateLimit * 1024)
-	}
-	if settings.BTsets.UploadRateLimit > 0 {
-		bt.config.UploadRateLimiter = utils.Limit(settings.BTsets.UploadRateLimit * 1024)
-	}
+	// limiters are changed by bandwidth schedule without reconnect
+	bt.downloadLimit, bt.uploadLimit = bt.rateLimits(time.Now())
+	bt.config.DownloadRateLimiter = utils.Limit(bt.downloadLimit * 1024)
+	bt.config.UploadRateLimiter = utils.Limit(bt.uploadLimit * 1024)
 	if settings.TorAddr != "" {
 		log.Println("Set listen addr", settings.TorAddr)
 		bt.config.SetListenAddr(settings.TorAddr)
 	} else {
-		if settings.BTsets.PeersListenPort > 0 {
-			log.Println("Set listen port", settings.BTsets.PeersListenPort)
-			bt.config.ListenPort = settings.BTsets.PeersListenPort
+		if sets.PeersListenPort > 0 {
+			log.Println("Set listen port", sets.PeersListenPort)
+			bt.config.ListenPort = sets.PeersListenPort
 		} else {
 			log.Println("Set listen port to random autoselect (0)")
 			bt.config.ListenPort = 0
 		}
 	}
 
-	log.Println("Client config:", settings.BTsets)
+	log.Println("Client config:", normalizeUser(bt.user), sets)
+	log.Println("Client quota:", normalizeUser(bt.user), quota)
 
 	var err error
 
@@ -166,7 +182,7 @@ func (bt *BTServer) configure(ctx context.Context) {
 			bt.config.PublicIp6 = ip6
 		}
 	}
-	if bt.config.PublicIp6 == nil && settings.BTsets.EnableIPv6 {
+	if bt.config.PublicIp6 == nil && sets.EnableIPv6 {
 		bt.config.PublicIp6, err = publicip.Get6(ctx)
 		if err != nil {
 			log.Printf("error getting public ipv6 address: %v", err)
@@ -180,6 +196,114 @@ func (bt *BTServer) configure(ctx context.Context) {
 	}
 }
 
+// Settings returns BTSets of server user merged with overrides and quota
+func (bt *BTServer) Settings() *settings.BTSets {
+	if sets := bt.sets.Load(); sets != nil {
+		return sets
+	}
+	return settings.BTsets
+}
+
+// effectiveSets returns BTSets of user merged with overrides and capped by user quota
+func effectiveSets(user string) (*settings.BTSets, *settings.UserQuota) {
+	quota := userQuota(user)
+	sets := settings.GetBTSets(user)
+	sets.CacheSize = minLimit(sets.CacheSize, quota.CacheSize)
+	sets.DownloadRateLimit = minLimit(sets.DownloadRateLimit, quota.DownloadRateLimit)
+	sets.UploadRateLimit = minLimit(sets.UploadRateLimit, quota.UploadRateLimit)
+	return sets, quota
+}
+
+// clientSets returns settings used to create torrent client and storage, their change needs restart of server
+func clientSets(sets *settings.BTSets) []any {
+	return []any{
+		sets.CacheSize, sets.SharedCache, sets.UseDisk, sets.TorrentsSavePath,
+		sets.ForceEncrypt, sets.EnableIPv6, sets.DisableTCP, sets.DisableUTP, sets.DisableUPNP,
+		sets.DisableDHT, sets.DisablePEX, sets.DisableUpload, sets.ConnectionsLimit, sets.PeersListenPort,
+	}
+}
+
+// applySettings updates settings of server in place, torrents and client are kept.
+// Changes of clientSets and config of client are applied on next connect.
+func (bt *BTServer) applySettings() {
+	sets, _ := effectiveSets(bt.user)
+	bt.sets.Store(sets)
+	bt.updateRateLimits(time.Now())
+}
+
+// Status returns state of server with active torrents, readers, cache fill and speeds
+func (bt *BTServer) Status() *state.ServerStatus {
+	st := &state.ServerStatus{User: bt.user, Streams: bt.ActiveStreams()}
+
+	bt.muTranscodes.Lock()
+	st.Transcodes = bt.transcodes
+	bt.muTranscodes.Unlock()
+
+	bt.mu.Lock()
+	st.Connected = bt.client != nil
+	st.DownloadRate = bt.downloadLimit
+	st.UploadRate = bt.uploadLimit
+	bt.mu.Unlock()
+
+	sets := bt.Settings()
+	st.IdleTimeout = int(idleTimeout(sets.ServerIdleTimeout) / time.Minute)
+	st.Pinned = sets.ServerPinned
+
+	serversMu.Lock()
+	if !bt.lastUsed.IsZero() {
+		st.LastUsed = bt.lastUsed.Unix()
+	}
+	fillEvictions(st)
+	serversMu.Unlock()
+
+	st.Torrents = make([]*state.TorrentStatus, 0)
+	for _, t := range bt.ListTorrents() {
+		cache := t.GetCache()
+		st.Readers += cache.GetUseReaders()
+		st.CacheFilled += cache.Filled()
+		st.CacheCapacity += cache.GetCapacity()
+
+		ts := t.Status()
+		ts.FileStats = nil // files are available from /torrents
+		st.DownloadSpeed += ts.DownloadSpeed
+		st.UploadSpeed += ts.UploadSpeed
+		st.Torrents = append(st.Torrents, ts)
+	}
+	sort.Slice(st.Torrents, func(i, j int) bool {
+		return st.Torrents[i].Timestamp > st.Torrents[j].Timestamp
+	})
+	return st
+}
+
+// busy reports whether server has active streams, readers or preloading torrents
+func (bt *BTServer) busy() bool {
+	if bt.ActiveStreams() > 0 {
+		return true
+	}
+	bt.muTranscodes.Lock()
+	transcodes := bt.transcodes
+	bt.muTranscodes.Unlock()
+	if transcodes > 0 {
+		return true
+	}
+	for _, t := range bt.ListTorrents() {
+		if t.GetCache().Readers() > 0 || t.GetCache().Downloading() || t.Stat == state.TorrentPreload {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveStreams returns count of http streams served now
+func (bt *BTServer) ActiveStreams() int64 {
+	return bt.streams.Load()
+}
+
+// StreamsTotal returns count of http streams served since server creation
+func (bt *BTServer) StreamsTotal() int64 {
+	return bt.streamsTotal.Load()
+}
+
 func (bt *BTServer) GetTorrent(hash torrent.InfoHash) *Torrent {
 	if torr, ok := bt.torrents[hash]; ok {
 		return torr
@@ -17,13 +17,20 @@ type tsFiles struct {
 }
 
 func AddTorrentDB(user string, torr *Torrent) {
+	settings.AddTorrent(user, torrentDB(torr))
+}
+
+func torrentDB(torr *Torrent) *settings.TorrentDB {
 	t := new(settings.TorrentDB)
 	t.TorrentSpec = torr.TorrentSpec
 	t.Title = torr.Title
 	t.Category = torr.Category
 	if torr.Data == "" {
 		files := new(tsFiles)
-		files.TorrServer.Files = torr.Status().FileStats
+		for _, f := range torr.Status().FileStats {
+			// media info is stored separately
+			files.TorrServer.Files = append(files.TorrServer.Files, &state.TorrentFileStat{Id: f.Id, Path: f.Path, Length: f.Length})
+		}
 		buf, err := json.Marshal(files)
 		if err == nil {
 			t.Data = string(buf)
@@ -32,6 +39,7 @@ func AddTorrentDB(user string, torr *Torrent) {
 	} else {
 		t.Data = torr.Data
 	}
+	t.Media = mediaDB(torr.mediaCopy())
 	if utils.CheckImgUrl(torr.Poster) {
 		t.Poster = torr.Poster
 	}
@@ -41,8 +49,39 @@ func AddTorrentDB(user string, torr *Torrent) {
 	}
 	// don't override timestamp from DB on edit
 	t.Timestamp = torr.Timestamp // time.Now().Unix()
+	return t
+}
+
+// TorrentFiles returns files of torrent from status, file list saved in data of torrent in db
+// or loads torrent info when torrent has neither
+func TorrentFiles(user string, torr *Torrent) []*state.TorrentFileStat {
+	if files := StoredFiles(torr); len(files) > 0 {
+		return files
+	}
+	if torr.Stat == state.TorrentInDB {
+		if torr = LoadTorrent(user, torr); torr == nil {
+			return nil
+		}
+	}
+	return torr.Status().FileStats
+}
 
-	settings.AddTorrent(user, t)
+// StoredFiles returns files of torrent from status or file list saved in data of torrent in db,
+// it never connects torrent
+func StoredFiles(torr *Torrent) []*state.TorrentFileStat {
+	if files := torr.Status().FileStats; len(files) > 0 {
+		return files
+	}
+	if torr.Data != "" {
+		files := new(tsFiles)
+		if err := json.Unmarshal([]byte(torr.Data), files); err == nil && len(files.TorrServer.Files) > 0 {
+			for _, f := range files.TorrServer.Files {
+				f.Media = torr.MediaInfo(f.Path)
+			}
+			return files.TorrServer.Files
+		}
+	}
+	return nil
 }
 
 func GetTorrentDB(user string, hash metainfo.Hash) *Torrent {
@@ -57,6 +96,7 @@ func GetTorrentDB(user string, hash metainfo.Hash) *Torrent {
 			torr.Timestamp = db.Timestamp
 			torr.Size = db.Size
 			torr.Data = db.Data
+			torr.setMediaDB(db.Media)
 			torr.Stat = state.TorrentInDB
 			return torr
 		}
@@ -80,6 +120,7 @@ func ListTorrentsDB(user string) map[metainfo.Hash]*Torrent {
 		torr.Timestamp = db.Timestamp
 		torr.Size = db.Size
 		torr.Data = db.Data
+		torr.setMediaDB(db.Media)
 		torr.Stat = state.TorrentInDB
 		ret[torr.TorrentSpec.InfoHash] = torr
 	}
@@ -98,6 +139,7 @@ func ListAllTorrentsDB() map[metainfo.Hash]*Torrent {
 		torr.Timestamp = db.Timestamp
 		torr.Size = db.Size
 		torr.Data = db.Data
+		torr.setMediaDB(db.Media)
 		torr.Stat = state.TorrentInDB
 		ret[torr.TorrentSpec.InfoHash] = torr
 	}
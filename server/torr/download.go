@@ -0,0 +1,167 @@
+package torr
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/log"
+	"server/settings"
+	"server/torr/state"
+	"server/torr/storage/torrstor"
+)
+
+// Download saves files with ids to DownloadPath/<user>/<hash>, without ids all files of torrent are saved.
+// Pieces of files are loaded without readers and torrent is not closed until files are complete.
+// Not complete files are stored in db, so download continues after restart.
+func (t *Torrent) Download(ids []int) error {
+	dir := settings.BTsets.DownloadPath
+	if dir == "" {
+		return errors.New("download path is not set")
+	}
+	if !t.GotInfo() {
+		return errors.New("timeout connection torrent")
+	}
+	if t.cache == nil {
+		return errors.New("torrent cache is not ready")
+	}
+
+	byPath := make(map[string]int64)
+	for _, f := range t.Files() {
+		byPath[f.Path()] = f.Offset()
+	}
+	// files of other torrents and users with same paths must not be taken as downloaded
+	user := normalizeUser(t.bt.user)
+	hash := t.Hash().HexString()
+	base := filepath.Clean(dir)
+	root := filepath.Join(base, user, hash)
+	if !strings.HasPrefix(root, base+string(filepath.Separator)) {
+		return errors.New("wrong download path of user")
+	}
+	var files []torrstor.DownloadFile
+	for _, f := range t.Status().FileStats {
+		if len(ids) > 0 && !slices.Contains(ids, f.Id) {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(f.Path))
+		if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+			log.TLogln("Skip download of file outside download path:", f.Path)
+			continue
+		}
+		files = append(files, torrstor.DownloadFile{Id: f.Id, Path: path, Offset: byPath[f.Path], Length: f.Length})
+	}
+	if len(files) == 0 {
+		return errors.New("file not found")
+	}
+
+	if err := t.cache.Download(files, torrstor.ProgressPath(base, user, hash)); err != nil {
+		return err
+	}
+	log.TLogln("Download", user, hash, "files:", len(files))
+	storeDownload(t.bt.user, t, t.downloadIds())
+	t.downloading.Store(true)
+	return nil
+}
+
+// checkDownload clears files in db when download is complete, so finished torrent is not resumed after restart
+func (t *Torrent) checkDownload() {
+	if t.downloading.Load() && !t.cache.Downloading() && t.downloading.CompareAndSwap(true, false) {
+		storeDownload(t.bt.user, t, t.downloadIds())
+	}
+}
+
+// DownloadTorrent starts torrent of user if it is only in db and downloads its files with ids
+func DownloadTorrent(user, hashHex string, ids []int) (*Torrent, error) {
+	tor := GetTorrent(user, hashHex)
+	if tor == nil {
+		return nil, errors.New("torrent not found")
+	}
+	if tor.Stat == state.TorrentInDB {
+		var err error
+		tor, err = AddTorrent(user, tor.TorrentSpec, tor.Title, tor.Poster, tor.Data, tor.Category)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tor, tor.Download(ids)
+}
+
+// StopDownload stops download of files with ids or of all files of torrent, saved data is kept
+func StopDownload(user, hashHex string, ids []int) {
+	hash := metainfo.NewHashFromHex(hashHex)
+	var tor *Torrent
+	if bt := getServer(user); bt != nil {
+		tor = bt.GetTorrent(hash)
+	}
+	if tor != nil && tor.cache != nil {
+		tor.cache.StopDownload(ids...)
+		storeDownload(user, tor, tor.downloadIds())
+		return
+	}
+	// torrent is not active, only list in db is changed
+	left := []int{}
+	if len(ids) > 0 {
+		for _, db := range settings.ListTorrent(user) {
+			if db.InfoHash == hash {
+				left = slices.DeleteFunc(db.Download, func(id int) bool {
+					return slices.Contains(ids, id)
+				})
+			}
+		}
+	}
+	storeDownload(user, GetTorrentDB(user, hash), left)
+}
+
+// downloadIds returns ids of not complete files of download
+func (t *Torrent) downloadIds() []int {
+	ids := []int{}
+	for _, st := range t.cache.DownloadState() {
+		if !st.Complete {
+			ids = append(ids, st.Id)
+		}
+	}
+	return ids
+}
+
+// storeDownload saves ids of downloading files to db, active torrent is added to db if it is not there
+func storeDownload(user string, t *Torrent, ids []int) {
+	if settings.ReadOnly || t == nil {
+		return
+	}
+	muMediaDB.Lock()
+	defer muMediaDB.Unlock()
+	tor := GetTorrentDB(user, t.Hash())
+	if tor == nil {
+		if len(ids) == 0 {
+			return
+		}
+		tor = t
+	}
+	db := torrentDB(tor)
+	db.Download = ids
+	settings.AddTorrent(user, db)
+}
+
+// ResumeDownloads continues downloads of user torrents after restart
+func ResumeDownloads(user string) {
+	if settings.BTsets.DownloadPath == "" {
+		return
+	}
+	for _, db := range settings.ListTorrent(user) {
+		if len(db.Download) == 0 || db.TorrentSpec == nil {
+			continue
+		}
+		go func() {
+			tor, err := AddTorrent(user, db.TorrentSpec, db.Title, db.Poster, db.Data, db.Category)
+			if err == nil {
+				err = tor.Download(db.Download)
+			}
+			if err != nil {
+				log.TLogln("Error resume download", user, db.InfoHash.HexString(), err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,93 @@
+package torr
+
+import (
+	"sort"
+	"strings"
+
+	"server/settings"
+	"server/torr/state"
+)
+
+// ListFilter selects, orders and pages torrents in FilterTorrents
+type ListFilter struct {
+	Category string             // exact category, empty - all
+	Search   string             // substring of title, case insensitive
+	Stat     *state.TorrentStat // nil - all
+	Viewed   *bool              // true - with viewed files, false - without
+	Sort     string             // added (def), title, size, viewed
+	Reverse  bool               // reverse order, def order is newest or largest first and title from A
+	Offset   int
+	Limit    int // 0 - all
+}
+
+// FilterTorrents returns page of torrents matched by filter and count of all matched torrents
+func FilterTorrents(user string, list []*Torrent, f *ListFilter) ([]*Torrent, int) {
+	var viewed map[string]int64
+	if f.Viewed != nil || f.Sort == "viewed" {
+		viewed = settings.LastViewed(user)
+	}
+	search := strings.ToLower(f.Search)
+
+	ret := make([]*Torrent, 0, len(list))
+	for _, t := range list {
+		if f.Category != "" && t.Category != f.Category {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(t.Title), search) {
+			continue
+		}
+		if f.Stat != nil && t.Stat != *f.Stat {
+			continue
+		}
+		if f.Viewed != nil {
+			if _, ok := viewed[t.Hash().HexString()]; ok != *f.Viewed {
+				continue
+			}
+		}
+		ret = append(ret, t)
+	}
+
+	// list is sorted by added, stable sort keeps it for equal keys
+	var less func(a, b *Torrent) bool
+	switch f.Sort {
+	case "title":
+		less = func(a, b *Torrent) bool {
+			return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+		}
+	case "size":
+		less = func(a, b *Torrent) bool {
+			return a.length() > b.length()
+		}
+	case "viewed":
+		less = func(a, b *Torrent) bool {
+			return viewed[a.Hash().HexString()] > viewed[b.Hash().HexString()]
+		}
+	default:
+		less = func(a, b *Torrent) bool {
+			return a.Timestamp > b.Timestamp
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if f.Reverse {
+			return less(ret[j], ret[i])
+		}
+		return less(ret[i], ret[j])
+	})
+
+	total := len(ret)
+	ret = ret[min(max(f.Offset, 0), total):]
+	if f.Limit > 0 && f.Limit < len(ret) {
+		ret = ret[:f.Limit]
+	}
+	return ret, total
+}
+
+// length returns size of torrent from info or from db
+func (t *Torrent) length() int64 {
+	t.muTorrent.Lock()
+	defer t.muTorrent.Unlock()
+	if t.Torrent != nil && t.Torrent.Info() != nil {
+		return t.Torrent.Length()
+	}
+	return t.Size
+}
@@ -0,0 +1,52 @@
+package torr
+
+import (
+	"testing"
+
+	"server/torr/state"
+)
+
+func TestFilterTorrents(t *testing.T) {
+	var list []*Torrent
+	for i, title := range []string{"Movie B", "Show", "movie a", "Movie C"} {
+		tor := &Torrent{Title: title, Category: "movie", Timestamp: int64(10 - i), Size: int64(i * 100)}
+		if title == "Show" {
+			tor.Category = "tv"
+			tor.Stat = state.TorrentWorking
+		}
+		list = append(list, tor)
+	}
+	titles := func(list []*Torrent) (ret []string) {
+		for _, t := range list {
+			ret = append(ret, t.Title)
+		}
+		return
+	}
+	stat := state.TorrentWorking
+	tests := []struct {
+		filter ListFilter
+		want   []string
+		total  int
+	}{
+		{ListFilter{}, []string{"Movie B", "Show", "movie a", "Movie C"}, 4},
+		{ListFilter{Category: "movie", Search: "MOVIE"}, []string{"Movie B", "movie a", "Movie C"}, 3},
+		{ListFilter{Stat: &stat}, []string{"Show"}, 1},
+		{ListFilter{Sort: "title"}, []string{"movie a", "Movie B", "Movie C", "Show"}, 4},
+		{ListFilter{Sort: "size", Reverse: true}, []string{"Movie B", "Show", "movie a", "Movie C"}, 4},
+		{ListFilter{Sort: "size", Offset: 1, Limit: 2}, []string{"movie a", "Show"}, 4},
+		{ListFilter{Offset: 10}, nil, 4},
+	}
+	for _, tt := range tests {
+		got, total := FilterTorrents("", list, &tt.filter)
+		if total != tt.total || len(got) != len(tt.want) {
+			t.Errorf("filter %+v: %v of %d, want %v of %d", tt.filter, titles(got), total, tt.want, tt.total)
+			continue
+		}
+		for i := range got {
+			if got[i].Title != tt.want[i] {
+				t.Errorf("filter %+v: %v, want %v", tt.filter, titles(got), tt.want)
+				break
+			}
+		}
+	}
+}
@@ -3,16 +3,28 @@ package torr
 import (
 	"sync"
 	"time"
+
+	"server/log"
+	"server/torr/state"
 )
 
 var (
 	serversMu sync.Mutex
 	servers   = make(map[string]*BTServer)
+	evictions = make(map[string]*eviction)
 
 	cleanupOnce sync.Once
 )
 
-const idleServerTimeout = 15 * time.Minute
+const defIdleServerTimeout = 15 * time.Minute
+
+// eviction holds disconnects of idle server of user
+type eviction struct {
+	count      int
+	last       time.Time
+	reconnects int
+	evicted    bool // server is not reconnected after last eviction
+}
 
 func startCleanupLoop() {
 	cleanupOnce.Do(func() {
@@ -21,6 +33,7 @@ func startCleanupLoop() {
 			defer ticker.Stop()
 			for range ticker.C {
 				cleanupStaleServers()
+				updateRateLimits()
 			}
 		}()
 	})
@@ -29,18 +42,46 @@ func startCleanupLoop() {
 func cleanupStaleServers() {
 	now := time.Now()
 
+	// busy takes locks of server and caches, it is checked without serversMu
 	serversMu.Lock()
-	stale := make([]*BTServer, 0)
+	current := make(map[string]*BTServer, len(servers))
 	for user, srv := range servers {
-		if srv.lastUsed.IsZero() {
+		current[user] = srv
+	}
+	serversMu.Unlock()
+	busy := make(map[string]bool, len(current))
+	for user, srv := range current {
+		busy[user] = srv.busy()
+	}
+
+	serversMu.Lock()
+	stale := make([]*BTServer, 0)
+	for user, srv := range current {
+		if servers[user] != srv {
+			// removed or replaced meanwhile
+			continue
+		}
+		// active readers and preloads are activity of user
+		if srv.lastUsed.IsZero() || busy[user] {
 			srv.lastUsed = now
 			continue
 		}
 
-		if now.Sub(srv.lastUsed) <= idleServerTimeout {
+		sets := srv.Settings()
+		if sets.ServerPinned || now.Sub(srv.lastUsed) <= idleTimeout(sets.ServerIdleTimeout) {
 			continue
 		}
 
+		ev := evictions[user]
+		if ev == nil {
+			ev = new(eviction)
+			evictions[user] = ev
+		}
+		ev.count++
+		ev.last = now
+		ev.evicted = true
+		log.TLogln("Disconnect idle torrent server", user, "idle", now.Sub(srv.lastUsed).Round(time.Second))
+
 		stale = append(stale, srv)
 		delete(servers, user)
 	}
@@ -51,6 +92,23 @@ func cleanupStaleServers() {
 	}
 }
 
+// idleTimeout returns timeout of idle server from settings value in minutes
+func idleTimeout(minutes int) time.Duration {
+	if minutes <= 0 {
+		return defIdleServerTimeout
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// fillEvictions sets evictions info of user to status, serversMu must be locked
+func fillEvictions(st *state.ServerStatus) {
+	if ev := evictions[st.User]; ev != nil {
+		st.Evictions = ev.count
+		st.LastEviction = ev.last.Unix()
+		st.Reconnects = ev.reconnects
+	}
+}
+
 func normalizeUser(user string) string {
 	if user == "" {
 		return "base"
@@ -73,8 +131,14 @@ func getOrCreateServer(user string) *BTServer {
 	}
 
 	srv := NewBTS()
+	srv.user = key
 	srv.lastUsed = now
 	servers[key] = srv
+	if ev := evictions[key]; ev != nil && ev.evicted {
+		ev.evicted = false
+		ev.reconnects++
+		log.TLogln("Reconnect torrent server of evicted user", key, "after", now.Sub(ev.last).Round(time.Second))
+	}
 	serversMu.Unlock()
 
 	return srv
@@ -91,6 +155,18 @@ func ConnectServer(user string) (*BTServer, error) {
 	return srv, srv.Connect()
 }
 
+func DisconnectServer(user string) {
+	key := normalizeUser(user)
+	serversMu.Lock()
+	srv, ok := servers[key]
+	delete(servers, key)
+	serversMu.Unlock()
+
+	if ok {
+		srv.Disconnect()
+	}
+}
+
 func DisconnectAllServers() {
 	serversMu.Lock()
 	current := make(map[string]*BTServer, len(servers))
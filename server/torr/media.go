@@ -0,0 +1,212 @@
+package torr
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+
+	goffprobe "gopkg.in/vansante/go-ffprobe.v2"
+
+	"server/ffprobe"
+	"server/log"
+	"server/settings"
+	"server/torr/state"
+)
+
+// muMediaDB serializes read-modify-write of probe results in torrent db
+var muMediaDB sync.Mutex
+
+// MediaInfo returns stored probe result of file path
+func (t *Torrent) MediaInfo(path string) *state.MediaInfo {
+	t.muMedia.Lock()
+	defer t.muMedia.Unlock()
+	return t.media[path]
+}
+
+func (t *Torrent) mediaCopy() map[string]*state.MediaInfo {
+	t.muMedia.Lock()
+	defer t.muMedia.Unlock()
+	if len(t.media) == 0 {
+		return nil
+	}
+	ret := make(map[string]*state.MediaInfo, len(t.media))
+	for k, v := range t.media {
+		ret[k] = v
+	}
+	return ret
+}
+
+func (t *Torrent) setMedia(media map[string]*state.MediaInfo) {
+	t.muMedia.Lock()
+	t.media = media
+	t.muMedia.Unlock()
+}
+
+// setMediaDB sets probe results stored in torrent db
+func (t *Torrent) setMediaDB(raw json.RawMessage) {
+	var media map[string]*state.MediaInfo
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &media); err != nil {
+			log.TLogln("Error unmarshal media info", t.Hash().HexString(), err)
+		}
+	}
+	t.setMedia(media)
+}
+
+// mediaDB encodes probe results for torrent db, settings keeps them as raw json
+func mediaDB(media map[string]*state.MediaInfo) json.RawMessage {
+	if len(media) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(media)
+	if err != nil {
+		log.TLogln("Error marshal media info", err)
+		return nil
+	}
+	return buf
+}
+
+// bitrate returns bits per second of probed file path, 0 if file is not probed
+func (t *Torrent) bitrate(path string) int64 {
+	info := t.MediaInfo(path)
+	if info == nil {
+		return 0
+	}
+	bitrate, _ := strconv.ParseInt(info.BitRate, 10, 64)
+	return bitrate
+}
+
+// Probe returns media info of file with index, ffprobe runs only once per file,
+// result is stored in torrent db when torrent is saved there
+func (t *Torrent) Probe(index int) (*state.MediaInfo, error) {
+	file := t.findFileIndex(index)
+	if file == nil {
+		return nil, errors.New("file not found")
+	}
+	if info := t.MediaInfo(file.Path()); info != nil {
+		return info, nil
+	}
+	t.muProbe.Lock()
+	defer t.muProbe.Unlock()
+	if info := t.MediaInfo(file.Path()); info != nil {
+		return info, nil
+	}
+	_, info, err := t.ProbeRaw(index)
+	return info, err
+}
+
+// ProbeRaw runs ffprobe for file with index and stores summary of result
+func (t *Torrent) ProbeRaw(index int) (*goffprobe.ProbeData, *state.MediaInfo, error) {
+	if !ffprobe.Exists() {
+		return nil, nil, errors.New("ffprobe not found")
+	}
+	if t.bt == nil {
+		return nil, nil, errors.New("torrent not active")
+	}
+	file := t.findFileIndex(index)
+	if file == nil {
+		return nil, nil, errors.New("file not found")
+	}
+	data, err := ffprobe.ProbeUrl(LocalPlayLink(t.bt.user, t.Hash().HexString(), index))
+	if err != nil {
+		return nil, nil, err
+	}
+	info := mediaInfo(data)
+	t.storeMedia(file.Path(), info)
+	return data, info, nil
+}
+
+func (t *Torrent) storeMedia(path string, info *state.MediaInfo) {
+	t.muMedia.Lock()
+	if t.media == nil {
+		t.media = make(map[string]*state.MediaInfo)
+	}
+	t.media[path] = info
+	t.muMedia.Unlock()
+
+	if settings.ReadOnly {
+		return
+	}
+	muMediaDB.Lock()
+	defer muMediaDB.Unlock()
+	user := t.bt.user
+	torrDb := GetTorrentDB(user, t.Hash())
+	if torrDb == nil {
+		return
+	}
+	media := torrDb.mediaCopy()
+	if media == nil {
+		media = make(map[string]*state.MediaInfo)
+	}
+	media[path] = info
+	torrDb.setMedia(media)
+	AddTorrentDB(user, torrDb)
+	log.TLogln("Media info saved", user, t.Hash().HexString(), path)
+}
+
+func mediaInfo(data *goffprobe.ProbeData) *state.MediaInfo {
+	info := new(state.MediaInfo)
+	if data.Format != nil {
+		info.Container = data.Format.FormatName
+		info.DurationSeconds = data.Format.DurationSeconds
+		info.BitRate = data.Format.BitRate
+	}
+	for _, s := range data.Streams {
+		if s == nil {
+			continue
+		}
+		ms := &state.MediaStream{
+			Index:    s.Index,
+			Type:     s.CodecType,
+			Codec:    s.CodecName,
+			Width:    s.Width,
+			Height:   s.Height,
+			Channels: s.Channels,
+			Default:  s.Disposition.Default == 1,
+		}
+		ms.Language, _ = s.TagList.GetString("language")
+		ms.Title, _ = s.TagList.GetString("title")
+		if s.CodecType == string(goffprobe.StreamVideo) && info.Width == 0 && s.Disposition.AttachedPic == 0 {
+			info.Width = s.Width
+			info.Height = s.Height
+		}
+		info.Streams = append(info.Streams, ms)
+	}
+	return info
+}
+
+// ProbeData returns stored media info in layout of ffprobe output, so /ffp clients get it without new probe
+func ProbeData(info *state.MediaInfo) *goffprobe.ProbeData {
+	data := &goffprobe.ProbeData{
+		Format: &goffprobe.Format{
+			FormatName:      info.Container,
+			DurationSeconds: info.DurationSeconds,
+			BitRate:         info.BitRate,
+			NBStreams:       len(info.Streams),
+		},
+		Streams: make([]*goffprobe.Stream, 0, len(info.Streams)),
+	}
+	for _, ms := range info.Streams {
+		s := &goffprobe.Stream{
+			Index:     ms.Index,
+			CodecType: ms.Type,
+			CodecName: ms.Codec,
+			Width:     ms.Width,
+			Height:    ms.Height,
+			Channels:  ms.Channels,
+			TagList:   goffprobe.Tags{},
+		}
+		if ms.Default {
+			s.Disposition.Default = 1
+		}
+		if ms.Language != "" {
+			s.TagList["language"] = ms.Language
+		}
+		if ms.Title != "" {
+			s.TagList["title"] = ms.Title
+		}
+		data.Streams = append(data.Streams, s)
+	}
+	return data
+}
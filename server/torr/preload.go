@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"server/ffprobe"
-	"strconv"
 
 	"github.com/anacrolix/torrent"
 
@@ -43,9 +42,6 @@ func (t *Torrent) Preload(index int, size int64) {
 	defer func() {
 		if t.Stat == state.TorrentPreload {
 			t.Stat = state.TorrentWorking
-			// Очистка по окончании прелоада
-			t.BitRate = ""
-			t.DurationSeconds = 0
 		}
 	}()
 
@@ -74,13 +70,9 @@ func (t *Torrent) Preload(index int, size int64) {
 		}()
 
 		if ffprobe.Exists() {
-			link := "http://127.0.0.1:" + settings.Port + "/play/" + t.Hash().HexString() + "/" + strconv.Itoa(index)
-			if settings.Ssl {
-				link = "https://127.0.0.1:" + settings.SslPort + "/play/" + t.Hash().HexString() + "/" + strconv.Itoa(index)
-			}
-			if data, err := ffprobe.ProbeUrl(link); err == nil {
-				t.BitRate = data.Format.BitRate
-				t.DurationSeconds = data.Format.DurationSeconds
+			if info, err := t.Probe(index); err == nil {
+				t.BitRate = info.BitRate
+				t.DurationSeconds = info.DurationSeconds
 			}
 		}
 
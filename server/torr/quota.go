@@ -0,0 +1,67 @@
+package torr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/settings"
+)
+
+var (
+	ErrQuotaExceeded  = errors.New("quota exceeded")
+	ErrQuotaForbidden = errors.New("forbidden by quota")
+)
+
+// userQuota reads quota of user, tests replace it because settings db is not opened there
+var userQuota = settings.GetUserQuota
+
+// QuotaStatus returns http status for quota errors or 0 for other errors
+func QuotaStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrQuotaForbidden):
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+func checkQuota(name string, used, max int) error {
+	if max < 0 {
+		return fmt.Errorf("%w: %s not allowed", ErrQuotaForbidden, name)
+	}
+	if max > 0 && used >= max {
+		return fmt.Errorf("%w: %s limit %d reached", ErrQuotaExceeded, name, max)
+	}
+	return nil
+}
+
+func (bt *BTServer) checkTorrentsQuota(hash metainfo.Hash) error {
+	quota := userQuota(bt.user)
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if _, ok := bt.torrents[hash]; ok {
+		return nil
+	}
+	return checkQuota("torrents", len(bt.torrents), quota.MaxTorrents)
+}
+
+func (bt *BTServer) checkReadersQuota() error {
+	quota := userQuota(bt.user)
+	readers := 0
+	for _, torr := range bt.ListTorrents() {
+		readers += torr.cache.Readers()
+	}
+	return checkQuota("readers", readers, quota.MaxReaders)
+}
+
+// minLimit returns the lowest positive limit, 0 is unlimited
+func minLimit[T int | int64](limit, quota T) T {
+	if quota > 0 && (limit <= 0 || quota < limit) {
+		return quota
+	}
+	return limit
+}
@@ -0,0 +1,65 @@
+package torr
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/settings"
+)
+
+func TestMinLimit(t *testing.T) {
+	tests := []struct {
+		limit, quota, want int64
+	}{
+		{0, 0, 0},
+		{100, 0, 100},
+		{0, 50, 50},
+		{100, 50, 50},
+		{50, 100, 50},
+		{50, 50, 50},
+		{-1, 50, 50},
+	}
+	for _, tt := range tests {
+		if got := minLimit(tt.limit, tt.quota); got != tt.want {
+			t.Errorf("minLimit(%d, %d) = %d, want %d", tt.limit, tt.quota, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTorrentsQuota(t *testing.T) {
+	old := userQuota
+	t.Cleanup(func() { userQuota = old })
+
+	bt := NewBTS()
+	open := metainfo.Hash{1}
+	bt.torrents[open] = &Torrent{}
+	bt.torrents[metainfo.Hash{2}] = &Torrent{}
+	added := metainfo.Hash{3}
+
+	tests := []struct {
+		max    int
+		hash   metainfo.Hash
+		want   error
+		status int
+	}{
+		{0, added, nil, 0},
+		{3, added, nil, 0},
+		{2, added, ErrQuotaExceeded, http.StatusTooManyRequests},
+		{2, open, nil, 0},
+		{1, added, ErrQuotaExceeded, http.StatusTooManyRequests},
+		{-1, added, ErrQuotaForbidden, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		userQuota = func(string) *settings.UserQuota { return &settings.UserQuota{MaxTorrents: tt.max} }
+		err := bt.checkTorrentsQuota(tt.hash)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("max %d hash %x: error %v, want %v", tt.max, tt.hash[:1], err, tt.want)
+		}
+		if got := QuotaStatus(err); got != tt.status {
+			t.Errorf("max %d hash %x: status %d, want %d", tt.max, tt.hash[:1], got, tt.status)
+		}
+	}
+}
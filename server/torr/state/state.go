@@ -38,6 +38,7 @@ type TorrentStatus struct {
 	Timestamp           int64       `json:"timestamp"`
 	Name                string      `json:"name,omitempty"`
 	Hash                string      `json:"hash,omitempty"`
+	Token               string      `json:"token,omitempty"` // signed stream token of hash when auth is enabled
 	Stat                TorrentStat `json:"stat"`
 	StatString          string      `json:"stat_string"`
 	LoadedSize          int64       `json:"loaded_size,omitempty"`
@@ -66,10 +67,65 @@ type TorrentStatus struct {
 	BitRate             string      `json:"bit_rate,omitempty"`
 
 	FileStats []*TorrentFileStat `json:"file_stats,omitempty"`
+	Downloads []*DownloadStatus  `json:"downloads,omitempty"`
+}
+
+// DownloadStatus is progress of torrent file saved to DownloadPath
+type DownloadStatus struct {
+	Id       int    `json:"id"`
+	Path     string `json:"path"`
+	Length   int64  `json:"length"`
+	Done     int64  `json:"done"`
+	Complete bool   `json:"complete,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
 type TorrentFileStat struct {
-	Id     int    `json:"id,omitempty"`
-	Path   string `json:"path,omitempty"`
-	Length int64  `json:"length,omitempty"`
+	Id     int        `json:"id,omitempty"`
+	Path   string     `json:"path,omitempty"`
+	Length int64      `json:"length,omitempty"`
+	Media  *MediaInfo `json:"media,omitempty"`
+}
+
+// MediaInfo is summary of ffprobe result for torrent file
+type MediaInfo struct {
+	Container       string         `json:"container,omitempty"`
+	DurationSeconds float64        `json:"duration_seconds,omitempty"`
+	BitRate         string         `json:"bit_rate,omitempty"`
+	Width           int            `json:"width,omitempty"`
+	Height          int            `json:"height,omitempty"`
+	Streams         []*MediaStream `json:"streams,omitempty"`
+}
+
+type MediaStream struct {
+	Index    int    `json:"index"`
+	Type     string `json:"type,omitempty"`
+	Codec    string `json:"codec,omitempty"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Channels int    `json:"channels,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+}
+
+type ServerStatus struct {
+	User          string           `json:"user"`
+	Connected     bool             `json:"connected"`
+	LastUsed      int64            `json:"last_used,omitempty"`
+	IdleTimeout   int              `json:"idle_timeout"` // in minutes
+	Pinned        bool             `json:"pinned,omitempty"`
+	Evictions     int              `json:"evictions,omitempty"`
+	LastEviction  int64            `json:"last_eviction,omitempty"`
+	Reconnects    int              `json:"reconnects,omitempty"`
+	Streams       int64            `json:"streams"`
+	Transcodes    int              `json:"transcodes"`
+	Readers       int              `json:"readers"`
+	CacheFilled   int64            `json:"cache_filled"`
+	CacheCapacity int64            `json:"cache_capacity"`
+	DownloadSpeed float64          `json:"download_speed"`
+	UploadSpeed   float64          `json:"upload_speed"`
+	DownloadRate  int              `json:"download_rate_limit"` // current limit in kb, 0 - inf
+	UploadRate    int              `json:"upload_rate_limit"`   // current limit in kb, 0 - inf
+	Torrents      []*TorrentStatus `json:"torrents"`
 }
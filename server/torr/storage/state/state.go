@@ -24,7 +24,8 @@ type ItemState struct {
 }
 
 type ReaderState struct {
-	Start  int
-	End    int
-	Reader int
+	Start     int
+	End       int
+	Reader    int
+	Readahead int64 // bytes, chosen by read rate or bitrate of file
 }
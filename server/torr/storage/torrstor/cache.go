@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/torrent"
@@ -22,8 +23,8 @@ type Cache struct {
 	storage.TorrentImpl
 	storage *Storage
 
-	capacity int64
-	filled   int64
+	capacity atomic.Int64 // max of capacities of storages in shared mode
+	filled   atomic.Int64
 	hash     metainfo.Hash
 
 	pieceLength int64
@@ -31,31 +32,42 @@ type Cache struct {
 
 	pieces map[int]*Piece
 
+	// disk cache only
+	index  *diskIndex
+	verify []int // pieces restored from disk, hashes are checked when torrent is set
+
+	download   *download
+	muDownload sync.Mutex
+
 	readers   map[*Reader]struct{}
 	muReaders sync.Mutex
 
 	isRemove bool
-	isClosed bool
+	isClosed atomic.Bool
 	muRemove sync.Mutex
-	torrent  *torrent.Torrent
+
+	// torrents of all users opened cache, more than one in shared mode
+	torrents   map[*torrent.Torrent]struct{}
+	muTorrents sync.Mutex
+	shared     bool
 }
 
 func NewCache(capacity int64, storage *Storage) *Cache {
 	ret := &Cache{
-		capacity: capacity,
-		filled:   0,
 		pieces:   make(map[int]*Piece),
 		storage:  storage,
 		readers:  make(map[*Reader]struct{}),
+		torrents: make(map[*torrent.Torrent]struct{}),
 	}
+	ret.capacity.Store(capacity)
 
 	return ret
 }
 
 func (c *Cache) Init(info *metainfo.Info, hash metainfo.Hash) {
 	log.TLogln("Create cache for:", info.Name, hash.HexString())
-	if c.capacity == 0 {
-		c.capacity = info.PieceLength * 4
+	if c.capacity.Load() == 0 {
+		c.capacity.Store(info.PieceLength * 4)
 	}
 
 	c.pieceLength = info.PieceLength
@@ -68,15 +80,93 @@ func (c *Cache) Init(info *metainfo.Info, hash metainfo.Hash) {
 		if err != nil {
 			log.TLogln("Error create dir:", err)
 		}
+		c.index = openDiskIndex(name, c.pieceLength)
+		addDiskCache(c)
 	}
 
 	for i := 0; i < c.pieceCount; i++ {
 		c.pieces[i] = NewPiece(i, c)
 	}
+
+	if c.index != nil {
+		restored := 0
+		for i := 0; i < c.pieceCount; i++ {
+			if p := c.pieces[i]; p.Complete.Load() {
+				restored++
+				if settings.BTsets.VerifyDiskCache {
+					// torrent sees piece as not completed until hash is checked
+					p.Complete.Store(false)
+					c.verify = append(c.verify, i)
+				}
+			}
+		}
+		if restored > 0 {
+			log.TLogln("Restore", restored, "pieces from disk cache for:", hash.HexString())
+		}
+		c.index.flush()
+	}
 }
 
 func (c *Cache) SetTorrent(torr *torrent.Torrent) {
-	c.torrent = torr
+	c.muTorrents.Lock()
+	c.torrents[torr] = struct{}{}
+	verify := c.verify
+	c.verify = nil
+	c.muTorrents.Unlock()
+
+	if len(verify) > 0 {
+		go c.verifyPieces(torr, verify)
+	}
+}
+
+// verifyPieces checks hashes of pieces restored from disk, torrent marks good pieces as completed
+func (c *Cache) verifyPieces(torr *torrent.Torrent, ids []int) {
+	for _, id := range ids {
+		select {
+		case <-torr.Closed():
+			return
+		default:
+		}
+		if c.isClosed.Load() {
+			return
+		}
+		torr.Piece(id).VerifyData()
+	}
+	log.TLogln("Verified", len(ids), "pieces from disk cache for:", c.hash.HexString())
+}
+
+// getTorrents returns opened torrents of cache and forgets closed ones
+func (c *Cache) getTorrents() []*torrent.Torrent {
+	c.muTorrents.Lock()
+	defer c.muTorrents.Unlock()
+	list := make([]*torrent.Torrent, 0, len(c.torrents))
+	for t := range c.torrents {
+		select {
+		case <-t.Closed():
+			delete(c.torrents, t)
+		default:
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// piecePriority returns highest priority of piece in all cache torrents
+func (c *Cache) piecePriority(id int) int {
+	prio := int(torrent.PiecePriorityNone)
+	for _, t := range c.getTorrents() {
+		if p := int(t.PieceState(id).Priority); p > prio {
+			prio = p
+		}
+	}
+	return prio
+}
+
+// updateCompletion notifies all cache torrents about changed piece state
+func (c *Cache) updateCompletion(id int) {
+	for _, t := range c.getTorrents() {
+		t.Piece(id).UpdateCompletion()
+	}
 }
 
 func (c *Cache) Piece(m metainfo.Piece) storage.PieceImpl {
@@ -88,9 +178,13 @@ func (c *Cache) Piece(m metainfo.Piece) storage.PieceImpl {
 
 func (c *Cache) Close() error {
 	log.TLogln("Close cache for:", c.hash)
-	c.isClosed = true
+	c.isClosed.Store(true)
+	removeDiskCache(c)
+	c.closeDownload()
 
-	delete(c.storage.caches, c.hash)
+	if !c.shared {
+		delete(c.storage.caches, c.hash)
+	}
 
 	if settings.BTsets.RemoveCacheOnDrop {
 		name := filepath.Join(settings.BTsets.TorrentsSavePath, c.hash.HexString())
@@ -100,10 +194,15 @@ func (c *Cache) Close() error {
 					os.Remove(v.dPiece.name)
 				}
 			}
+			c.index.drop()
 			os.Remove(name)
 		}
+	} else if c.index != nil {
+		c.touchPieces()
 	}
 
+	c.index.flush()
+
 	c.muReaders.Lock()
 	c.readers = nil
 	c.pieces = nil
@@ -114,19 +213,21 @@ func (c *Cache) Close() error {
 }
 
 func (c *Cache) removePiece(piece *Piece) {
-	if !c.isClosed {
+	if !c.isClosed.Load() {
 		piece.Release()
 	}
 }
 
-func (c *Cache) AdjustRA(readahead int64) {
+// AdjustRA sets readahead of every reader by its speed, bitrate returns bits per second
+// of file from ffprobe or 0 if file is not probed
+func (c *Cache) AdjustRA(bitrate func(path string) int64) {
 	if settings.BTsets.CacheSize == 0 {
-		c.capacity = readahead * 3
+		c.capacity.Store(defaultReadahead * 3)
 	}
 	if c.Readers() > 0 {
 		c.muReaders.Lock()
 		for r := range c.readers {
-			r.SetReadahead(readahead)
+			r.SetReadahead(c.readahead(r.Rate(), bitrate(r.file.Path()), len(c.readers)))
 		}
 		c.muReaders.Unlock()
 	}
@@ -140,14 +241,14 @@ func (c *Cache) GetState() *state.CacheState {
 
 	if len(c.pieces) > 0 {
 		for _, p := range c.pieces {
-			if p.Size > 0 {
-				fill += p.Size
+			if size := p.Size.Load(); size > 0 {
+				fill += size
 				piecesState[p.Id] = state.ItemState{
 					Id:        p.Id,
-					Size:      p.Size,
+					Size:      size,
 					Length:    c.pieceLength,
-					Completed: p.Complete,
-					Priority:  int(c.torrent.PieceState(p.Id).Priority),
+					Completed: p.Complete.Load(),
+					Priority:  c.piecePriority(p.Id),
 				}
 			}
 		}
@@ -161,16 +262,17 @@ func (c *Cache) GetState() *state.CacheState {
 			rng := r.getPiecesRange()
 			pc := r.getReaderPiece()
 			readersState = append(readersState, &state.ReaderState{
-				Start:  rng.Start,
-				End:    rng.End,
-				Reader: pc,
+				Start:     rng.Start,
+				End:       rng.End,
+				Reader:    pc,
+				Readahead: r.Readahead(),
 			})
 		}
 		c.muReaders.Unlock()
 	}
 
-	c.filled = fill
-	cState.Capacity = c.capacity
+	c.filled.Store(fill)
+	cState.Capacity = c.capacity.Load()
 	cState.PiecesLength = c.pieceLength
 	cState.PiecesCount = c.pieceCount
 	cState.Hash = c.hash.HexString()
@@ -181,7 +283,7 @@ func (c *Cache) GetState() *state.CacheState {
 }
 
 func (c *Cache) cleanPieces() {
-	if c.isRemove || c.isClosed {
+	if c.isClosed.Load() {
 		return
 	}
 	c.muRemove.Lock()
@@ -190,12 +292,16 @@ func (c *Cache) cleanPieces() {
 		return
 	}
 	c.isRemove = true
-	defer func() { c.isRemove = false }()
 	c.muRemove.Unlock()
+	defer func() {
+		c.muRemove.Lock()
+		c.isRemove = false
+		c.muRemove.Unlock()
+	}()
 
 	remPieces := c.getRemPieces()
-	if c.filled > c.capacity {
-		rems := (c.filled-c.capacity)/c.pieceLength + 1
+	if filled, capacity := c.filled.Load(), c.capacity.Load(); filled > capacity {
+		rems := (filled-capacity)/c.pieceLength + 1
 		for _, p := range remPieces {
 			c.removePiece(p)
 			rems--
@@ -223,18 +329,22 @@ func (c *Cache) getRemPieces() []*Piece {
 	ranges = mergeRange(ranges)
 
 	for id, p := range c.pieces {
-		if p.Size > 0 {
-			fill += p.Size
+		size := p.Size.Load()
+		if size > 0 {
+			fill += size
+		}
+		if c.pinned(id) {
+			continue
 		}
 		if len(ranges) > 0 {
 			if !inRanges(ranges, id) {
-				if p.Size > 0 && !c.isIdInFileBE(ranges, id) {
+				if size > 0 && !c.isIdInFileBE(ranges, id) {
 					piecesRemove = append(piecesRemove, p)
 				}
 			}
 		} else {
 			// on preload clean
-			if p.Size > 0 && !c.isIdInFileBE(ranges, id) {
+			if size > 0 && !c.isIdInFileBE(ranges, id) {
 				piecesRemove = append(piecesRemove, p)
 			}
 		}
@@ -244,15 +354,16 @@ func (c *Cache) getRemPieces() []*Piece {
 	c.setLoadPriority(ranges)
 
 	sort.Slice(piecesRemove, func(i, j int) bool {
-		return piecesRemove[i].Accessed < piecesRemove[j].Accessed
+		return piecesRemove[i].Accessed.Load() < piecesRemove[j].Accessed.Load()
 	})
 
-	c.filled = fill
+	c.filled.Store(fill)
 	return piecesRemove
 }
 
 func (c *Cache) setLoadPriority(ranges []Range) {
 	c.muReaders.Lock()
+	readers := make([]*readerStat, 0, len(c.readers))
 	for r := range c.readers {
 		if !r.isUse {
 			continue
@@ -260,29 +371,34 @@ func (c *Cache) setLoadPriority(ranges []Range) {
 		if c.isIdInFileBE(ranges, r.getReaderPiece()) {
 			continue
 		}
-		readerPos := r.getReaderPiece()
-		readerRAHPos := r.getReaderRAHPiece()
-		end := r.getPiecesRange().End
-		count := settings.BTsets.ConnectionsLimit / len(c.readers) // max concurrent loading blocks
-		limit := 0
-		for i := readerPos; i < end && limit < count; i++ {
-			if !c.pieces[i].Complete {
-				if i == readerPos {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityNow)
-				} else if i == readerPos+1 {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityNext)
-				} else if i > readerPos && i <= readerRAHPos {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityReadahead)
-				} else if i > readerRAHPos && i <= readerRAHPos+5 && c.torrent.PieceState(i).Priority != torrent.PiecePriorityHigh {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityHigh)
-				} else if i > readerRAHPos+5 && c.torrent.PieceState(i).Priority != torrent.PiecePriorityNormal {
-					c.torrent.Piece(i).SetPriority(torrent.PiecePriorityNormal)
-				}
-				limit++
-			}
-		}
+		readers = append(readers, c.readerStat(r))
 	}
 	c.muReaders.Unlock()
+
+	// max concurrent loading blocks of all readers
+	schedule(readers, settings.BTsets.ConnectionsLimit, c.pieceComplete).apply()
+}
+
+// readerStat returns position, buffered bytes and read rate of reader for scheduler
+func (c *Cache) readerStat(r *Reader) *readerStat {
+	st := &readerStat{
+		target: torrentTarget{r.file.Torrent()},
+		pos:    r.getReaderPiece(),
+		rah:    r.getReaderRAHPiece(),
+		end:    r.getPiecesRange().End,
+		rate:   r.Rate(),
+	}
+	offset := r.offset.Load() + r.file.Offset()
+	for id := st.pos; id <= st.end && c.pieceComplete(id); id++ {
+		st.buffered += int64(id+1)*c.pieceLength - offset
+		offset = int64(id+1) * c.pieceLength
+	}
+	return st
+}
+
+func (c *Cache) pieceComplete(id int) bool {
+	p, ok := c.pieces[id]
+	return ok && p.Complete.Load()
 }
 
 func (c *Cache) isIdInFileBE(ranges []Range, id int) bool {
@@ -314,6 +430,13 @@ func (c *Cache) NewReader(file *torrent.File) *Reader {
 	return newReader(file, c)
 }
 
+func (c *Cache) Filled() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.filled.Load()
+}
+
 func (c *Cache) GetUseReaders() int {
 	if c == nil {
 		return 0
@@ -362,16 +485,14 @@ func (c *Cache) clearPriority() {
 	c.muReaders.Unlock()
 	ranges = mergeRange(ranges)
 
+	torrents := c.getTorrents()
 	for id := range c.pieces {
-		if len(ranges) > 0 {
-			if !inRanges(ranges, id) {
-				if c.torrent.PieceState(id).Priority != torrent.PiecePriorityNone {
-					c.torrent.Piece(id).SetPriority(torrent.PiecePriorityNone)
-				}
-			}
-		} else {
-			if c.torrent.PieceState(id).Priority != torrent.PiecePriorityNone {
-				c.torrent.Piece(id).SetPriority(torrent.PiecePriorityNone)
+		if len(ranges) > 0 && inRanges(ranges, id) || c.pinned(id) {
+			continue
+		}
+		for _, torr := range torrents {
+			if torr.PieceState(id).Priority != torrent.PiecePriorityNone {
+				torr.Piece(id).SetPriority(torrent.PiecePriorityNone)
 			}
 		}
 	}
@@ -381,5 +502,5 @@ func (c *Cache) GetCapacity() int64 {
 	if c == nil {
 		return 0
 	}
-	return c.capacity
+	return c.capacity.Load()
 }
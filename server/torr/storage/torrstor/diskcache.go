@@ -0,0 +1,267 @@
+package torrstor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/log"
+	"server/settings"
+)
+
+// open disk caches of all users, caches of closed torrents exist only as files in TorrentsSavePath
+var (
+	diskCaches   = make(map[*Cache]struct{})
+	muDiskCaches sync.Mutex
+
+	diskTrimOnce    sync.Once
+	diskTrimTrigger = make(chan struct{}, 1)
+	muDiskTrim      sync.Mutex
+)
+
+// DiskCacheState is usage of disk cache of all torrents
+type DiskCacheState struct {
+	Path     string `json:"path"`
+	Budget   int64  `json:"budget"` // DiskCacheSize, 0 - unlimited
+	Used     int64  `json:"used"`
+	Torrents int    `json:"torrents"`
+	Pieces   int    `json:"pieces"`
+	Freed    int64  `json:"freed,omitempty"` // removed by trim
+}
+
+// diskCachePiece is piece file of disk cache, piece of open cache or just file of closed one
+type diskCachePiece struct {
+	name      string
+	size      int64
+	accessed  int64
+	protected bool     // needed by readers
+	pieces    []*Piece // pieces of open caches, empty for closed torrent
+}
+
+func addDiskCache(c *Cache) {
+	muDiskCaches.Lock()
+	diskCaches[c] = struct{}{}
+	muDiskCaches.Unlock()
+	diskTrimOnce.Do(func() {
+		go diskTrimWatcher()
+	})
+}
+
+func removeDiskCache(c *Cache) {
+	muDiskCaches.Lock()
+	delete(diskCaches, c)
+	muDiskCaches.Unlock()
+}
+
+// diskCacheChanged asks watcher to check budget, calls are merged while trim is running
+func diskCacheChanged() {
+	select {
+	case diskTrimTrigger <- struct{}{}:
+	default:
+	}
+}
+
+func diskTrimWatcher() {
+	for range diskTrimTrigger {
+		if settings.BTsets.UseDisk && settings.BTsets.DiskCacheSize > 0 {
+			TrimDiskCache(settings.BTsets.DiskCacheSize)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// DiskCache returns usage of disk cache
+func DiskCache() *DiskCacheState {
+	st := &DiskCacheState{Path: settings.BTsets.TorrentsSavePath, Budget: settings.BTsets.DiskCacheSize}
+	if !settings.BTsets.UseDisk {
+		return st
+	}
+	for _, list := range scanDiskCache() {
+		st.Torrents++
+		for _, p := range list {
+			st.Used += p.size
+			st.Pieces++
+		}
+	}
+	return st
+}
+
+// TrimDiskCache removes least recently accessed pieces of all torrents until disk cache fits budget,
+// pieces in reader ranges are never removed
+func TrimDiskCache(budget int64) *DiskCacheState {
+	muDiskTrim.Lock()
+	defer muDiskTrim.Unlock()
+
+	st := &DiskCacheState{Path: settings.BTsets.TorrentsSavePath, Budget: settings.BTsets.DiskCacheSize}
+	if !settings.BTsets.UseDisk {
+		return st
+	}
+	dirs := scanDiskCache()
+	var candidates []*diskCachePiece
+	for _, list := range dirs {
+		for _, p := range list {
+			st.Used += p.size
+			st.Pieces++
+			if !p.protected {
+				candidates = append(candidates, p)
+			}
+		}
+	}
+	st.Torrents = len(dirs)
+	if st.Used <= budget {
+		return st
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].accessed < candidates[j].accessed
+	})
+	for _, p := range candidates {
+		if st.Used <= budget {
+			break
+		}
+		if len(p.pieces) > 0 {
+			for _, piece := range p.pieces {
+				piece.cache.removePiece(piece)
+			}
+		} else if err := os.Remove(p.name); err != nil && !os.IsNotExist(err) {
+			log.TLogln("Error remove piece:", err)
+			continue
+		}
+		st.Used -= p.size
+		st.Freed += p.size
+		st.Pieces--
+	}
+	removeEmptyDirs(dirs)
+	log.TLogln("Trim disk cache, freed:", st.Freed, "used:", st.Used, "budget:", budget)
+	return st
+}
+
+// scanDiskCache returns piece files of every torrent dir, open caches report their pieces from memory
+func scanDiskCache() map[string][]*diskCachePiece {
+	root := settings.BTsets.TorrentsSavePath
+	ret := make(map[string][]*diskCachePiece)
+	if root == "" || root == "/" {
+		return ret
+	}
+
+	open := make(map[metainfo.Hash][]*Cache)
+	muDiskCaches.Lock()
+	for c := range diskCaches {
+		if !c.isClosed.Load() {
+			open[c.hash] = append(open[c.hash], c)
+		}
+	}
+	muDiskCaches.Unlock()
+
+	for hash, caches := range open {
+		ret[hash.HexString()] = openCachePieces(caches)
+	}
+
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return ret
+	}
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 40 {
+			continue
+		}
+		if _, ok := ret[d.Name()]; ok {
+			continue
+		}
+		ret[d.Name()] = closedCachePieces(filepath.Join(root, d.Name()))
+	}
+	return ret
+}
+
+// openCachePieces merges pieces of caches of same torrent opened by several users
+func openCachePieces(caches []*Cache) []*diskCachePiece {
+	byId := make(map[int]*diskCachePiece)
+	for _, c := range caches {
+		ranges := c.readerRanges()
+		for id, p := range c.pieces {
+			size := p.Size.Load()
+			if size <= 0 || p.dPiece == nil {
+				continue
+			}
+			dp, ok := byId[id]
+			if !ok {
+				dp = &diskCachePiece{name: p.dPiece.name}
+				byId[id] = dp
+			}
+			dp.size = max(dp.size, size)
+			dp.accessed = max(dp.accessed, p.Accessed.Load())
+			dp.protected = dp.protected || inRanges(ranges, id) || c.isIdInFileBE(ranges, id) || c.pinned(id)
+			dp.pieces = append(dp.pieces, p)
+		}
+	}
+	ret := make([]*diskCachePiece, 0, len(byId))
+	for _, dp := range byId {
+		ret = append(ret, dp)
+	}
+	return ret
+}
+
+func closedCachePieces(dir string) []*diskCachePiece {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	ret := make([]*diskCachePiece, 0, len(files))
+	for _, f := range files {
+		if _, err := strconv.Atoi(f.Name()); err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		ret = append(ret, &diskCachePiece{
+			name:     filepath.Join(dir, f.Name()),
+			size:     info.Size(),
+			accessed: info.ModTime().Unix(),
+		})
+	}
+	return ret
+}
+
+// readerRanges returns pieces needed by all readers of cache
+func (c *Cache) readerRanges() []Range {
+	c.muReaders.Lock()
+	defer c.muReaders.Unlock()
+	ranges := make([]Range, 0, len(c.readers))
+	for r := range c.readers {
+		ranges = append(ranges, r.getPiecesRange())
+	}
+	return mergeRange(ranges)
+}
+
+// removeEmptyDirs removes dirs of closed torrents without pieces left
+func removeEmptyDirs(dirs map[string][]*diskCachePiece) {
+	root := settings.BTsets.TorrentsSavePath
+	for name, list := range dirs {
+		if len(list) == 0 || len(list[0].pieces) > 0 {
+			continue
+		}
+		dir := filepath.Join(root, name)
+		if len(closedCachePieces(dir)) > 0 {
+			continue
+		}
+		os.Remove(filepath.Join(dir, diskIndexName))
+		os.Remove(dir)
+	}
+}
+
+// touchPieces saves access time of pieces in file time, so closed caches are trimmed by last access
+func (c *Cache) touchPieces() {
+	for _, p := range c.pieces {
+		if accessed := p.Accessed.Load(); p.dPiece != nil && p.Size.Load() > 0 && accessed > 0 {
+			tm := time.Unix(accessed, 0)
+			os.Chtimes(p.dPiece.name, tm, tm)
+		}
+	}
+}
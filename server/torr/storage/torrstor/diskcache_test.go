@@ -0,0 +1,162 @@
+package torrstor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/settings"
+)
+
+func init() {
+	// tests swap settings.BTsets, background trim must not read them, trim is called directly
+	diskTrimOnce.Do(func() {})
+}
+
+// writePieces creates piece files of closed torrent cache, accessed is age of piece in minutes
+func writePieces(t *testing.T, root, hash string, size int, ages ...int) {
+	dir := filepath.Join(root, hash)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	for id, age := range ages {
+		name := filepath.Join(dir, strconv.Itoa(id))
+		if err := os.WriteFile(name, make([]byte, size), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		tm := time.Now().Add(-time.Duration(age) * time.Minute)
+		os.Chtimes(name, tm, tm)
+	}
+}
+
+func infoHash(t *testing.T, info *metainfo.Info) metainfo.Hash {
+	buf, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metainfo.HashBytes(buf)
+}
+
+// addTorrent adds torrent of info to client without network and returns its cache
+func addTorrent(t *testing.T, info *metainfo.Info, capacity int64) (*torrent.Torrent, *Cache) {
+	buf, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stor := NewStorage(capacity, false)
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.DefaultStorage = stor
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.NoDefaultPortForwarding = true
+	cfg.ListenPort = 0
+	cl, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	tor, err := cl.AddTorrent(&metainfo.MetaInfo{InfoBytes: buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := stor.GetCache(tor.InfoHash())
+	if c == nil {
+		t.Fatal("cache is not opened")
+	}
+	return tor, c
+}
+
+func TestTrimDiskCacheClosedTorrents(t *testing.T) {
+	root := t.TempDir()
+	old := settings.BTsets
+	settings.BTsets = &settings.BTSets{UseDisk: true, TorrentsSavePath: root}
+	t.Cleanup(func() { settings.BTsets = old })
+
+	hashA := strings.Repeat("a", 40)
+	hashB := strings.Repeat("b", 40)
+	writePieces(t, root, hashA, 100, 50, 40)
+	writePieces(t, root, hashB, 100, 30, 10, 20)
+	os.WriteFile(filepath.Join(root, hashA, diskIndexName), []byte("{}"), 0o666)
+
+	st := DiskCache()
+	if st.Used != 500 || st.Pieces != 5 || st.Torrents != 2 {
+		t.Fatalf("usage %+v", st)
+	}
+
+	st = TrimDiskCache(250)
+	if st.Used != 200 || st.Freed != 300 {
+		t.Fatalf("after trim %+v", st)
+	}
+	// all pieces of A and oldest of B are removed
+	if _, err := os.Stat(filepath.Join(root, hashA)); !os.IsNotExist(err) {
+		t.Error("empty cache dir is not removed")
+	}
+	for id, want := range []bool{false, true, true} {
+		_, err := os.Stat(filepath.Join(root, hashB, strconv.Itoa(id)))
+		if (err == nil) != want {
+			t.Errorf("piece %d of B exists %v, want %v", id, err == nil, want)
+		}
+	}
+
+	if st = TrimDiskCache(1000); st.Freed != 0 || st.Used != 200 {
+		t.Errorf("trim under budget %+v", st)
+	}
+}
+
+func TestTrimDiskCacheOpenTorrent(t *testing.T) {
+	root := t.TempDir()
+	old := settings.BTsets
+	settings.BTsets = &settings.BTSets{UseDisk: true, TorrentsSavePath: root, ReaderReadAHead: 50, ConnectionsLimit: 25}
+	t.Cleanup(func() { settings.BTsets = old })
+
+	// 8 pieces of 4 mb, first and last 8 mb of file are kept for players
+	const pieceLength = 4 << 20
+	info := &metainfo.Info{Name: "file", Length: 8 * pieceLength, PieceLength: pieceLength, Pieces: make([]byte, 8*20)}
+	hash := infoHash(t, info).HexString()
+	// protected pieces are the oldest ones
+	writePieces(t, root, hash, pieceLength, 80, 70, 20, 60, 50, 40, 10, 30)
+
+	tor, c := addTorrent(t, info, 2*pieceLength)
+	r := c.NewReader(tor.Files()[0])
+	// reader range is 4 mb before and after offset, pieces 3-5 while it reads first half of piece 4
+	if _, err := r.Seek(4*pieceLength, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	// player reads piece 4 while cache is trimmed
+	done := make(chan error)
+	go func() {
+		buf := make([]byte, 64<<10)
+		var err error
+		for i := 0; i < 32 && err == nil; i++ {
+			_, err = io.ReadFull(r, buf)
+		}
+		done <- err
+	}()
+	st := TrimDiskCache(0)
+	if err := <-done; err != nil {
+		t.Fatal("read while trim:", err)
+	}
+	if st.Freed != 2*pieceLength || st.Pieces != 6 {
+		t.Errorf("after trim %+v", st)
+	}
+	for id := 0; id < 8; id++ {
+		want := id != 2 && id != 6
+		if _, err := os.Stat(filepath.Join(root, hash, strconv.Itoa(id))); (err == nil) != want {
+			t.Errorf("piece %d exists %v, want %v", id, err == nil, want)
+		}
+		if c.pieces[id].Complete.Load() != want {
+			t.Errorf("piece %d complete %v, want %v", id, c.pieces[id].Complete.Load(), want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package torrstor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"server/log"
+)
+
+const (
+	diskIndexName      = "index.json"
+	diskIndexSaveDelay = 5 * time.Second
+)
+
+// diskIndex keeps completed and verified pieces of disk cache, so they are not downloaded again after restart
+type diskIndex struct {
+	name string
+	data diskIndexData
+
+	// pieces from index file, moved to data while cache restores pieces found on disk
+	saved  map[int]int64
+	legacy bool // cache dir without index file, full size pieces are taken as completed
+
+	timer *time.Timer
+	mu    sync.Mutex
+}
+
+type diskIndexData struct {
+	PieceLength int64         `json:"piece_length"`
+	Pieces      map[int]int64 `json:"pieces"` // id of piece -> size of piece file
+}
+
+func openDiskIndex(dir string, pieceLength int64) *diskIndex {
+	idx := &diskIndex{
+		name: filepath.Join(dir, diskIndexName),
+		data: diskIndexData{PieceLength: pieceLength, Pieces: make(map[int]int64)},
+	}
+	buf, err := os.ReadFile(idx.name)
+	if os.IsNotExist(err) {
+		idx.legacy = true
+		return idx
+	}
+	var saved diskIndexData
+	if err == nil {
+		err = json.Unmarshal(buf, &saved)
+	}
+	if err != nil {
+		log.TLogln("Error read disk cache index:", err)
+		return idx
+	}
+	if saved.PieceLength == pieceLength {
+		idx.saved = saved.Pieces
+	}
+	return idx
+}
+
+// restore returns true if piece file of size on disk is completed piece
+func (idx *diskIndex) restore(id int, size int64) bool {
+	if idx == nil || size <= 0 {
+		return false
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.legacy {
+		if size != idx.data.PieceLength {
+			return false
+		}
+	} else if idx.saved[id] != size {
+		return false
+	}
+	idx.data.Pieces[id] = size
+	return true
+}
+
+func (idx *diskIndex) set(id int, size int64) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.data.Pieces[id] == size {
+		return
+	}
+	idx.data.Pieces[id] = size
+	idx.saveLater()
+}
+
+func (idx *diskIndex) remove(id int) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, ok := idx.data.Pieces[id]; !ok {
+		return
+	}
+	delete(idx.data.Pieces, id)
+	idx.saveLater()
+}
+
+// saveLater writes index after delay, so pieces completed at once are saved together
+func (idx *diskIndex) saveLater() {
+	if idx.timer == nil {
+		idx.timer = time.AfterFunc(diskIndexSaveDelay, idx.flush)
+	}
+}
+
+// flush writes index to disk if it has changes
+func (idx *diskIndex) flush() {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.timer == nil && !idx.legacy && idx.saved == nil {
+		return
+	}
+	if idx.timer != nil {
+		idx.timer.Stop()
+		idx.timer = nil
+	}
+	idx.legacy = false
+	idx.saved = nil
+
+	buf, err := json.Marshal(idx.data)
+	if err != nil {
+		log.TLogln("Error marshal disk cache index:", err)
+		return
+	}
+	// write to temp file and rename, so index is never half written
+	tmp := idx.name + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0o666); err == nil {
+		err = os.Rename(tmp, idx.name)
+	}
+	if err != nil {
+		log.TLogln("Error write disk cache index:", err)
+	}
+}
+
+// drop removes index file with cache
+func (idx *diskIndex) drop() {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.timer != nil {
+		idx.timer.Stop()
+		idx.timer = nil
+	}
+	os.Remove(idx.name)
+}
@@ -0,0 +1,138 @@
+package torrstor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/settings"
+)
+
+func TestDiskIndexRestore(t *testing.T) {
+	dir := t.TempDir()
+	idx := openDiskIndex(dir, 1024)
+	idx.set(0, 1024)
+	idx.set(1, 1024)
+	idx.set(2, 100) // last piece
+	idx.remove(1)
+	idx.flush()
+
+	idx = openDiskIndex(dir, 1024)
+	if !idx.restore(0, 1024) {
+		t.Error("piece 0 is not restored")
+	}
+	if idx.restore(1, 1024) {
+		t.Error("removed piece 1 is restored")
+	}
+	if !idx.restore(2, 100) {
+		t.Error("short last piece is not restored")
+	}
+	if idx.restore(3, 1024) {
+		t.Error("piece 3 not in index is restored")
+	}
+	idx.flush()
+
+	// piece 2 is not restored from disk, it must be dropped from index
+	idx = openDiskIndex(dir, 1024)
+	if !idx.restore(0, 1024) || idx.restore(2, 50) {
+		t.Error("index doesn't follow files on disk")
+	}
+}
+
+func TestDiskIndexSizeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	idx := openDiskIndex(dir, 1024)
+	idx.set(0, 1024)
+	idx.flush()
+
+	if openDiskIndex(dir, 1024).restore(0, 512) {
+		t.Error("partially written piece is restored")
+	}
+	if openDiskIndex(dir, 2048).restore(0, 1024) {
+		t.Error("piece is restored with other piece length")
+	}
+}
+
+func TestDiskIndexLegacy(t *testing.T) {
+	dir := t.TempDir()
+	idx := openDiskIndex(dir, 1024)
+	if !idx.restore(0, 1024) || idx.restore(1, 10) {
+		t.Error("cache without index must restore only full pieces")
+	}
+	idx.flush()
+	if _, err := os.Stat(filepath.Join(dir, diskIndexName)); err != nil {
+		t.Fatal("index of legacy cache is not written:", err)
+	}
+	if !openDiskIndex(dir, 1024).restore(0, 1024) {
+		t.Error("piece 0 is not saved in index")
+	}
+}
+
+func TestCacheRestoreVerify(t *testing.T) {
+	root := t.TempDir()
+	old := settings.BTsets
+	settings.BTsets = &settings.BTSets{UseDisk: true, TorrentsSavePath: root, VerifyDiskCache: true, ConnectionsLimit: 25}
+	t.Cleanup(func() { settings.BTsets = old })
+
+	const pieceLength = 16 << 10
+	data := bytes.Repeat([]byte("0123456789abcdef"), 3*pieceLength/16)
+	info := &metainfo.Info{Name: "file", Length: int64(len(data)), PieceLength: pieceLength}
+	err := info.GeneratePieces(func(metainfo.FileInfo) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := infoHash(t, info)
+
+	// piece 0 is good, piece 1 is damaged and piece 2 file is gone, all of them are in index
+	dir := filepath.Join(root, hash.HexString())
+	idx := openDiskIndex(dir, pieceLength)
+	os.MkdirAll(dir, 0o777)
+	for id := 0; id < 3; id++ {
+		idx.set(id, pieceLength)
+	}
+	idx.flush()
+	os.WriteFile(filepath.Join(dir, "0"), data[:pieceLength], 0o666)
+	os.WriteFile(filepath.Join(dir, "1"), make([]byte, pieceLength), 0o666)
+
+	tor, c := addTorrent(t, info, 0)
+	for id, p := range []*Piece{c.pieces[0], c.pieces[1], c.pieces[2]} {
+		if p.Complete.Load() {
+			t.Errorf("restored piece %d is completed before verification", id)
+		}
+	}
+	if len(c.verify) != 2 || c.verify[0] != 0 || c.verify[1] != 1 {
+		t.Errorf("pieces to verify %v, want [0 1]", c.verify)
+	}
+	if saved := openDiskIndex(dir, pieceLength); saved.restore(2, pieceLength) {
+		t.Error("piece without file is kept in index")
+	}
+
+	// damaged piece is verified last and removed from index
+	c.SetTorrent(tor)
+	deadline := time.Now().Add(5 * time.Second)
+	for !tor.PieceState(0).Complete || c.index.has(1) {
+		if time.Now().After(deadline) {
+			t.Fatal("restored pieces are not verified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for id := 1; id < 3; id++ {
+		if tor.PieceState(id).Complete || c.pieces[id].Complete.Load() {
+			t.Errorf("piece %d is completed", id)
+		}
+	}
+}
+
+func (idx *diskIndex) has(id int) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	_, ok := idx.data.Pieces[id]
+	return ok
+}
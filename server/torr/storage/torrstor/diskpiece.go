@@ -24,9 +24,9 @@ func NewDiskPiece(p *Piece) *DiskPiece {
 	name := filepath.Join(settings.BTsets.TorrentsSavePath, p.cache.hash.HexString(), strconv.Itoa(p.Id))
 	ff, err := os.Stat(name)
 	if err == nil {
-		p.Size = ff.Size()
-		p.Complete = ff.Size() == p.cache.pieceLength
-		p.Accessed = ff.ModTime().Unix()
+		p.Size.Store(ff.Size())
+		p.Complete.Store(p.cache.index.restore(p.Id, ff.Size()))
+		p.Accessed.Store(ff.ModTime().Unix())
 	}
 	return &DiskPiece{piece: p, name: name}
 }
@@ -43,11 +43,8 @@ func (p *DiskPiece) WriteAt(b []byte, off int64) (n int, err error) {
 	defer ff.Close()
 	n, err = ff.WriteAt(b, off)
 
-	p.piece.Size += int64(n)
-	if p.piece.Size > p.piece.cache.pieceLength {
-		p.piece.Size = p.piece.cache.pieceLength
-	}
-	p.piece.Accessed = time.Now().Unix()
+	p.piece.Size.Store(min(p.piece.Size.Load()+int64(n), p.piece.cache.pieceLength))
+	p.piece.Accessed.Store(time.Now().Unix())
 	return
 }
 
@@ -67,19 +64,51 @@ func (p *DiskPiece) ReadAt(b []byte, off int64) (n int, err error) {
 
 	n, err = ff.ReadAt(b, off)
 
-	p.piece.Accessed = time.Now().Unix()
-	if int64(len(b))+off >= p.piece.Size {
-		go p.piece.cache.cleanPieces()
+	// reads of not completed piece are hash checks, not playback
+	if p.piece.Complete.Load() {
+		p.piece.Accessed.Store(time.Now().Unix())
+		if int64(len(b))+off >= p.piece.Size.Load() {
+			go p.piece.cache.cleanPieces()
+		}
 	}
 	return n, nil
 }
 
+func (p *DiskPiece) readAll(b []byte) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ff, err := os.Open(p.name)
+	if err != nil {
+		return 0
+	}
+	defer ff.Close()
+	n, _ := ff.ReadAt(b, 0)
+	return n
+}
+
+// markComplete saves verified piece to index with real size of file
+func (p *DiskPiece) markComplete() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ff, err := os.Stat(p.name)
+	if err != nil {
+		log.TLogln("Error stat piece:", err)
+		return
+	}
+	p.piece.Size.Store(ff.Size())
+	p.piece.cache.index.set(p.piece.Id, ff.Size())
+	diskCacheChanged()
+}
+
 func (p *DiskPiece) Release() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.piece.Size = 0
-	p.piece.Complete = false
+	p.piece.Size.Store(0)
+	p.piece.Complete.Store(false)
+	p.piece.cache.index.remove(p.piece.Id)
 
 	os.Remove(p.name)
 }
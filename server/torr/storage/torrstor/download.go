@@ -0,0 +1,463 @@
+package torrstor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+
+	"server/log"
+	"server/settings"
+	"server/torr/state"
+)
+
+// DownloadFile is torrent file saved outside of cache
+type DownloadFile struct {
+	Id     int    // id of file in torrent status
+	Path   string // target path, data is written to Path.part until file is complete
+	Offset int64  // offset of file in torrent
+	Length int64
+}
+
+// download copies completed pieces of chosen files to their target files. Pieces of files keep
+// Normal priority and are not removed from cache until they are copied.
+type download struct {
+	cache    *Cache
+	progress string // file with copied pieces, download continues from it after restart
+	files    map[int]*downloadFile
+	pending  map[int]int // pieces not copied yet -> count of files waiting for them
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{} // closed when run returns
+	dirty    bool
+	mu       sync.Mutex
+}
+
+type downloadFile struct {
+	DownloadFile
+	first, last int // pieces of file
+	copied      map[int]bool
+	done        int64
+	complete    bool
+	err         error
+	file        *os.File
+}
+
+type downloadProgress struct {
+	PieceLength int64         `json:"piece_length"`
+	Files       map[int][]int `json:"files"` // id of file -> copied pieces
+}
+
+// Download adds files to download of cache, files already added keep their progress
+func (c *Cache) Download(files []DownloadFile, progress string) error {
+	if c.isClosed.Load() {
+		return errors.New("cache closed")
+	}
+	c.muDownload.Lock()
+	defer c.muDownload.Unlock()
+	d := c.download
+	if d == nil {
+		d = &download{
+			cache:    c,
+			progress: progress,
+			files:    make(map[int]*downloadFile),
+			pending:  make(map[int]int),
+			wake:     make(chan struct{}, 1),
+			stop:     make(chan struct{}),
+			done:     make(chan struct{}),
+		}
+	}
+	saved := d.loadProgress()
+
+	d.mu.Lock()
+	for _, f := range files {
+		if _, ok := d.files[f.Id]; ok || f.Length <= 0 {
+			continue
+		}
+		df := &downloadFile{
+			DownloadFile: f,
+			first:        int(f.Offset / c.pieceLength),
+			last:         int((f.Offset + f.Length - 1) / c.pieceLength),
+			copied:       make(map[int]bool),
+		}
+		if st, err := os.Stat(f.Path); err == nil && st.Size() == f.Length {
+			// downloaded before
+			df.complete = true
+			df.done = f.Length
+		} else {
+			for _, id := range saved[f.Id] {
+				if id >= df.first && id <= df.last && !df.copied[id] {
+					df.copied[id] = true
+					df.done += df.overlap(id, c.pieceLength)
+				}
+			}
+			for id := df.first; id <= df.last; id++ {
+				if !df.copied[id] {
+					d.pending[id]++
+				}
+			}
+		}
+		d.files[f.Id] = df
+		log.TLogln("Download file", f.Path, "done", df.done, "of", f.Length)
+	}
+	d.mu.Unlock()
+
+	if c.download == nil {
+		c.download = d
+		go d.run()
+	}
+	d.signal()
+	return nil
+}
+
+// StopDownload removes files from download, without ids download of all files is stopped.
+// Copied data and progress are kept, so download continues when files are added again.
+func (c *Cache) StopDownload(ids ...int) {
+	c.muDownload.Lock()
+	defer c.muDownload.Unlock()
+	d := c.download
+	if d == nil {
+		return
+	}
+	// progress of removed files stays in progress file
+	d.saveProgress()
+	d.mu.Lock()
+	for id, f := range d.files {
+		if len(ids) > 0 && !slices.Contains(ids, id) {
+			continue
+		}
+		d.removeFile(f)
+	}
+	left := len(d.files)
+	d.mu.Unlock()
+
+	if left == 0 {
+		d.close()
+		c.download = nil
+	}
+}
+
+// Downloading returns true while some chosen file is not complete
+func (c *Cache) Downloading() bool {
+	if c == nil {
+		return false
+	}
+	c.muDownload.Lock()
+	d := c.download
+	c.muDownload.Unlock()
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending) > 0
+}
+
+// DownloadState returns progress of chosen files
+func (c *Cache) DownloadState() []*state.DownloadStatus {
+	if c == nil {
+		return nil
+	}
+	c.muDownload.Lock()
+	d := c.download
+	c.muDownload.Unlock()
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ret := make([]*state.DownloadStatus, 0, len(d.files))
+	for _, f := range d.files {
+		st := &state.DownloadStatus{
+			Id:       f.Id,
+			Path:     f.Path,
+			Length:   f.Length,
+			Done:     f.done,
+			Complete: f.complete,
+		}
+		if f.err != nil {
+			st.Error = f.err.Error()
+		}
+		ret = append(ret, st)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Id < ret[j].Id
+	})
+	return ret
+}
+
+// pinned returns true if piece must stay in cache until it is copied
+func (c *Cache) pinned(id int) bool {
+	c.muDownload.Lock()
+	d := c.download
+	c.muDownload.Unlock()
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending[id] > 0
+}
+
+// pieceCompleted wakes download to copy piece
+func (c *Cache) pieceCompleted() {
+	c.muDownload.Lock()
+	d := c.download
+	c.muDownload.Unlock()
+	if d != nil {
+		d.signal()
+	}
+}
+
+func (c *Cache) closeDownload() {
+	c.muDownload.Lock()
+	defer c.muDownload.Unlock()
+	if c.download != nil {
+		c.download.close()
+		c.download = nil
+	}
+}
+
+func (d *download) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *download) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastSave := time.Now()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		d.step()
+		if time.Since(lastSave) > 10*time.Second {
+			d.saveProgress()
+			lastSave = time.Now()
+		}
+	}
+}
+
+// step copies completed pending pieces and sets Normal priority to next pieces to load
+func (d *download) step() {
+	c := d.cache
+	d.mu.Lock()
+	ids := make([]int, 0, len(d.pending))
+	for id := range d.pending {
+		ids = append(ids, id)
+	}
+	d.mu.Unlock()
+	sort.Ints(ids)
+
+	window := settings.BTsets.ConnectionsLimit
+	if !settings.BTsets.UseDisk {
+		// memory cache holds whole pieces, don't load more than it can keep
+		window = min(window, max(2, int(c.capacity.Load()/c.pieceLength)))
+	}
+	torrents := c.getTorrents()
+	for _, id := range ids {
+		if c.isClosed.Load() {
+			return
+		}
+		p, ok := c.pieces[id]
+		if !ok {
+			continue
+		}
+		if p.Complete.Load() {
+			d.copyPiece(p)
+			continue
+		}
+		if window <= 0 {
+			continue
+		}
+		window--
+		for _, t := range torrents {
+			if t.PieceState(id).Priority < torrent.PiecePriorityNormal {
+				t.Piece(id).SetPriority(torrent.PiecePriorityNormal)
+			}
+		}
+	}
+}
+
+func (d *download) copyPiece(p *Piece) {
+	pl := d.cache.pieceLength
+	buf := make([]byte, pl)
+	buf = buf[:p.readAll(buf)]
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, f := range d.files {
+		if f.complete || f.copied[p.Id] || p.Id < f.first || p.Id > f.last {
+			continue
+		}
+		start := max(int64(p.Id)*pl, f.Offset)
+		end := min(int64(p.Id+1)*pl, f.Offset+f.Length)
+		from, to := start-int64(p.Id)*pl, end-int64(p.Id)*pl
+		if to > int64(len(buf)) {
+			// piece was removed while reading, it is loaded again
+			return
+		}
+		if err := f.write(buf[from:to], start-f.Offset); err != nil {
+			if f.err == nil {
+				log.TLogln("Error write downloaded file:", f.Path, err)
+			}
+			f.err = err
+			continue
+		}
+		f.err = nil
+		f.copied[p.Id] = true
+		f.done += end - start
+		d.dirty = true
+		d.unpend(p.Id)
+		if len(f.copied) == f.last-f.first+1 {
+			f.finish()
+		}
+	}
+}
+
+func (d *download) unpend(id int) {
+	if d.pending[id]--; d.pending[id] <= 0 {
+		delete(d.pending, id)
+	}
+}
+
+// removeFile forgets file and its pending pieces, d.mu must be locked
+func (d *download) removeFile(f *downloadFile) {
+	if !f.complete {
+		for id := f.first; id <= f.last; id++ {
+			if !f.copied[id] {
+				d.unpend(id)
+			}
+		}
+	}
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	delete(d.files, f.Id)
+}
+
+// close stops run and waits for it, so files are not written after they are closed
+func (d *download) close() {
+	close(d.stop)
+	<-d.done
+	d.saveProgress()
+	d.mu.Lock()
+	for _, f := range d.files {
+		if f.file != nil {
+			f.file.Close()
+			f.file = nil
+		}
+	}
+	d.mu.Unlock()
+}
+
+func (d *download) loadProgress() map[int][]int {
+	buf, err := os.ReadFile(d.progress)
+	if err != nil {
+		return nil
+	}
+	var pr downloadProgress
+	if err = json.Unmarshal(buf, &pr); err != nil || pr.PieceLength != d.cache.pieceLength {
+		return nil
+	}
+	return pr.Files
+}
+
+// saveProgress writes copied pieces of incomplete files, progress file is removed when all files are complete
+func (d *download) saveProgress() {
+	d.mu.Lock()
+	if !d.dirty {
+		d.mu.Unlock()
+		return
+	}
+	d.dirty = false
+	pr := downloadProgress{PieceLength: d.cache.pieceLength, Files: make(map[int][]int)}
+	// progress of stopped files is kept
+	for id, pieces := range d.loadProgress() {
+		pr.Files[id] = pieces
+	}
+	for _, f := range d.files {
+		delete(pr.Files, f.Id)
+		if f.complete {
+			continue
+		}
+		pieces := make([]int, 0, len(f.copied))
+		for id := range f.copied {
+			pieces = append(pieces, id)
+		}
+		sort.Ints(pieces)
+		pr.Files[f.Id] = pieces
+	}
+	d.mu.Unlock()
+
+	if len(pr.Files) == 0 {
+		os.Remove(d.progress)
+		return
+	}
+	buf, err := json.Marshal(pr)
+	if err == nil {
+		os.MkdirAll(filepath.Dir(d.progress), 0o777)
+		tmp := d.progress + ".tmp"
+		if err = os.WriteFile(tmp, buf, 0o666); err == nil {
+			err = os.Rename(tmp, d.progress)
+		}
+	}
+	if err != nil {
+		log.TLogln("Error save download progress:", err)
+	}
+}
+
+// overlap returns bytes of piece in file
+func (f *downloadFile) overlap(id int, pieceLength int64) int64 {
+	start := max(int64(id)*pieceLength, f.Offset)
+	end := min(int64(id+1)*pieceLength, f.Offset+f.Length)
+	return max(end-start, 0)
+}
+
+func (f *downloadFile) write(b []byte, off int64) error {
+	if f.file == nil {
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0o777); err != nil {
+			return err
+		}
+		ff, err := os.OpenFile(f.Path+".part", os.O_RDWR|os.O_CREATE, 0o666)
+		if err != nil {
+			return err
+		}
+		f.file = ff
+	}
+	_, err := f.file.WriteAt(b, off)
+	return err
+}
+
+func (f *downloadFile) finish() {
+	f.complete = true
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	if err := os.Rename(f.Path+".part", f.Path); err != nil {
+		f.err = err
+		log.TLogln("Error rename downloaded file:", err)
+		return
+	}
+	log.TLogln("Downloaded file", f.Path)
+}
+
+// ProgressPath returns path of download progress file of user torrent
+func ProgressPath(dir, user, hash string) string {
+	return filepath.Join(dir, ".progress", user, hash+".json")
+}
@@ -0,0 +1,99 @@
+package torrstor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"server/settings"
+)
+
+// memCache returns cache of memory pieces with given data, pieces are not completed
+func memCache(t *testing.T, pieceLength int64, data string) *Cache {
+	old := settings.BTsets
+	settings.BTsets = &settings.BTSets{ConnectionsLimit: 25}
+	t.Cleanup(func() { settings.BTsets = old })
+
+	c := NewCache(1<<20, nil)
+	c.pieceLength = pieceLength
+	c.pieceCount = int((int64(len(data)) + pieceLength - 1) / pieceLength)
+	for i := 0; i < c.pieceCount; i++ {
+		p := NewPiece(i, c)
+		end := min(int64(i+1)*pieceLength, int64(len(data)))
+		p.mPiece.buffer = make([]byte, pieceLength)
+		p.Size.Store(int64(copy(p.mPiece.buffer, data[int64(i)*pieceLength:end])))
+		c.pieces[i] = p
+	}
+	t.Cleanup(func() { c.closeDownload() })
+	return c
+}
+
+func waitDownload(t *testing.T, c *Cache, check func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("download state %+v", c.DownloadState())
+		}
+		c.pieceCompleted()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDownloadCopiesPieces(t *testing.T) {
+	dir := t.TempDir()
+	// piece 1 is shared by both files
+	c := memCache(t, 4, "aaaaaabbbbb")
+	files := []DownloadFile{
+		{Id: 1, Path: filepath.Join(dir, "a.txt"), Offset: 0, Length: 6},
+		{Id: 2, Path: filepath.Join(dir, "sub", "b.txt"), Offset: 6, Length: 5},
+	}
+	progress := ProgressPath(dir, "user", "hash")
+	if err := c.Download(files, progress); err != nil {
+		t.Fatal(err)
+	}
+	if !c.pinned(0) || !c.pinned(2) {
+		t.Error("pieces of download are not pinned")
+	}
+
+	c.pieces[0].Complete.Store(true)
+	c.pieces[1].Complete.Store(true)
+	waitDownload(t, c, func() bool {
+		st := c.DownloadState()
+		return st[0].Complete && st[1].Done == 2
+	})
+	if buf, _ := os.ReadFile(files[0].Path); string(buf) != "aaaaaa" {
+		t.Errorf("file a %q", buf)
+	}
+	if c.pinned(1) {
+		t.Error("copied piece is pinned")
+	}
+	if !c.Downloading() {
+		t.Error("download of b is not complete")
+	}
+
+	// stop and continue from saved progress
+	c.StopDownload()
+	if c.Downloading() {
+		t.Error("download is not stopped")
+	}
+	if err := c.Download(files, progress); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.DownloadState(); !st[0].Complete || st[1].Done != 2 {
+		t.Fatalf("progress is not restored %+v %+v", st[0], st[1])
+	}
+	c.pieces[2].Complete.Store(true)
+	waitDownload(t, c, func() bool {
+		return c.DownloadState()[1].Complete
+	})
+	if buf, _ := os.ReadFile(files[1].Path); string(buf) != "bbbbb" {
+		t.Errorf("file b %q", buf)
+	}
+	if _, err := os.Stat(files[1].Path + ".part"); !os.IsNotExist(err) {
+		t.Error("part file is left")
+	}
+	if c.Downloading() {
+		t.Error("download is not complete")
+	}
+}
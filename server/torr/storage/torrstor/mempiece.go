@@ -26,14 +26,17 @@ func (p *MemPiece) WriteAt(b []byte, off int64) (n int, err error) {
 		p.buffer = make([]byte, p.piece.cache.pieceLength, p.piece.cache.pieceLength)
 	}
 	n = copy(p.buffer[off:], b[:])
-	p.piece.Size += int64(n)
-	if p.piece.Size > p.piece.cache.pieceLength {
-		p.piece.Size = p.piece.cache.pieceLength
-	}
-	p.piece.Accessed = time.Now().Unix()
+	p.piece.Size.Store(min(p.piece.Size.Load()+int64(n), p.piece.cache.pieceLength))
+	p.piece.Accessed.Store(time.Now().Unix())
 	return
 }
 
+func (p *MemPiece) readAll(b []byte) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return copy(b, p.buffer)
+}
+
 func (p *MemPiece) ReadAt(b []byte, off int64) (n int, err error) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -49,9 +52,12 @@ func (p *MemPiece) ReadAt(b []byte, off int64) (n int, err error) {
 		return 0, io.EOF
 	}
 	n = copy(b, p.buffer[int(off) : int(off)+size][:])
-	p.piece.Accessed = time.Now().Unix()
-	if int64(len(b))+off >= p.piece.Size {
-		go p.piece.cache.cleanPieces()
+	// reads of not completed piece are hash checks, not playback
+	if p.piece.Complete.Load() {
+		p.piece.Accessed.Store(time.Now().Unix())
+		if int64(len(b))+off >= p.piece.Size.Load() {
+			go p.piece.cache.cleanPieces()
+		}
 	}
 	if n == 0 {
 		return 0, io.EOF
@@ -65,6 +71,6 @@ func (p *MemPiece) Release() {
 	if p.buffer != nil {
 		p.buffer = nil
 	}
-	p.piece.Size = 0
-	p.piece.Complete = false
+	p.piece.Size.Store(0)
+	p.piece.Complete.Store(false)
 }
@@ -1,6 +1,8 @@
 package torrstor
 
 import (
+	"sync/atomic"
+
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/storage"
 	"server/settings"
@@ -9,11 +11,12 @@ import (
 type Piece struct {
 	storage.PieceImpl `json:"-"`
 
-	Id   int   `json:"-"`
-	Size int64 `json:"size"`
+	Id int `json:"-"`
 
-	Complete bool  `json:"complete"`
-	Accessed int64 `json:"accessed"`
+	// set by torrent and read by download, trim and cleaning goroutines
+	Size     atomic.Int64 `json:"-"`
+	Complete atomic.Bool  `json:"-"`
+	Accessed atomic.Int64 `json:"-"`
 
 	mPiece *MemPiece  `json:"-"`
 	dPiece *DiskPiece `json:"-"`
@@ -51,19 +54,37 @@ func (p *Piece) ReadAt(b []byte, off int64) (n int, err error) {
 	}
 }
 
+// readAll copies data of piece for download, unlike ReadAt it doesn't mark piece as accessed
+// and doesn't start cleaning of cache
+func (p *Piece) readAll(b []byte) int {
+	if p.dPiece != nil {
+		return p.dPiece.readAll(b)
+	}
+	return p.mPiece.readAll(b)
+}
+
 func (p *Piece) MarkComplete() error {
-	p.Complete = true
+	p.Complete.Store(true)
+	if p.dPiece != nil {
+		p.dPiece.markComplete()
+	}
+	p.cache.pieceCompleted()
+	if p.cache.shared {
+		// let torrents of other users know about piece
+		go p.cache.updateCompletion(p.Id)
+	}
 	return nil
 }
 
 func (p *Piece) MarkNotComplete() error {
-	p.Complete = false
+	p.Complete.Store(false)
+	p.cache.index.remove(p.Id)
 	return nil
 }
 
 func (p *Piece) Completion() storage.Completion {
 	return storage.Completion{
-		Complete: p.Complete,
+		Complete: p.Complete.Load(),
 		Ok:       true,
 	}
 }
@@ -74,8 +95,10 @@ func (p *Piece) Release() {
 	} else {
 		p.dPiece.Release()
 	}
-	if !p.cache.isClosed {
-		p.cache.torrent.Piece(p.Id).SetPriority(torrent.PiecePriorityNone)
-		p.cache.torrent.Piece(p.Id).UpdateCompletion()
+	if !p.cache.isClosed.Load() {
+		for _, t := range p.cache.getTorrents() {
+			t.Piece(p.Id).SetPriority(torrent.PiecePriorityNone)
+			t.Piece(p.Id).UpdateCompletion()
+		}
 	}
 }
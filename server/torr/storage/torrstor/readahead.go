@@ -0,0 +1,36 @@
+package torrstor
+
+const (
+	readaheadSeconds = 30       // seconds of playback loaded ahead of reader
+	defaultReadahead = 16 << 20 // reader without measured rate and bitrate
+	minReadahead     = 4 << 20
+	maxReadaheadPart = 2 // readers share at most half of cache for readahead, rest keeps played data
+)
+
+// readahead returns readahead of reader for its speed, speed is read rate of player or
+// bitrate of file from ffprobe, what is bigger. Result is not less than two pieces and
+// not more than reader share of cache part for readahead.
+func (c *Cache) readahead(rate float64, bitrate int64, readers int) int64 {
+	speed := rate
+	if bps := float64(bitrate) / 8; bps > speed {
+		speed = bps
+	}
+	ra := int64(defaultReadahead)
+	if speed > 0 {
+		ra = int64(speed * readaheadSeconds)
+	}
+
+	minRA := max(int64(minReadahead), c.pieceLength*2)
+	capacity := c.capacity.Load()
+	maxRA := capacity / maxReadaheadPart / int64(max(readers, 1))
+	if ra > maxRA {
+		ra = maxRA
+	}
+	if ra < minRA {
+		ra = minRA
+	}
+	if ra > capacity {
+		ra = capacity
+	}
+	return ra
+}
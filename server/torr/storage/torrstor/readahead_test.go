@@ -0,0 +1,43 @@
+package torrstor
+
+import "testing"
+
+func newTestCache(pieceLength, capacity int64) *Cache {
+	c := NewCache(capacity, nil)
+	c.pieceLength = pieceLength
+	return c
+}
+
+func TestReadahead(t *testing.T) {
+	c := newTestCache(1<<20, 200<<20)
+	tests := []struct {
+		name    string
+		rate    float64
+		bitrate int64
+		readers int
+		want    int64
+	}{
+		{"default", 0, 0, 1, defaultReadahead},
+		{"rate", 1 << 20, 0, 1, 30 << 20},
+		{"bitrate", 0, 8 << 20, 1, 30 << 20},
+		{"faster of rate and bitrate", 1 << 20, 16 << 20, 1, 60 << 20},
+		{"min", 10 << 10, 0, 1, minReadahead},
+		{"max", 10 << 20, 0, 1, 100 << 20},
+		{"max shared by readers", 10 << 20, 0, 4, 25 << 20},
+		{"min over reader share", 1 << 20, 0, 100, minReadahead},
+	}
+	for _, tt := range tests {
+		if got := c.readahead(tt.rate, tt.bitrate, tt.readers); got != tt.want {
+			t.Errorf("%s: readahead %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	big := newTestCache(16<<20, 200<<20)
+	if got := big.readahead(0, 0, 1); got != 32<<20 {
+		t.Errorf("two pieces: readahead %d, want %d", got, 32<<20)
+	}
+	small := newTestCache(1<<20, 2<<20)
+	if got := small.readahead(1<<20, 0, 1); got != 2<<20 {
+		t.Errorf("capacity: readahead %d, want %d", got, 2<<20)
+	}
+}
@@ -3,6 +3,7 @@ package torrstor
 import (
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/torrent"
@@ -13,12 +14,13 @@ import (
 
 type Reader struct {
 	torrent.Reader
-	offset    int64
+	offset    atomic.Int64 // read by cache ranges and disk trim while player reads
 	readahead int64
 	file      *torrent.File
 
 	cache    *Cache
 	isClosed bool
+	rate     readRate
 
 	///Preload
 	lastAccess int64
@@ -47,15 +49,15 @@ func (r *Reader) Seek(offset int64, whence int) (n int64, err error) {
 	}
 	switch whence {
 	case io.SeekStart:
-		r.offset = offset
+		r.offset.Store(offset)
 	case io.SeekCurrent:
-		r.offset += offset
+		r.offset.Add(offset)
 	case io.SeekEnd:
-		r.offset = r.file.Length() + offset
+		r.offset.Store(r.file.Length() + offset)
 	}
 	r.readerOn()
 	n, err = r.Reader.Seek(offset, whence)
-	r.offset = n
+	r.offset.Store(n)
 	r.lastAccess = time.Now().Unix()
 	return
 }
@@ -87,7 +89,8 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 		//	}
 		//}
 
-		r.offset += int64(n)
+		r.offset.Add(int64(n))
+		r.rate.add(n)
 		r.lastAccess = time.Now().Unix()
 	} else {
 		log.TLogln("Torrent closed and readed")
@@ -96,8 +99,8 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 }
 
 func (r *Reader) SetReadahead(length int64) {
-	if r.cache != nil && length > r.cache.capacity {
-		length = r.cache.capacity
+	if r.cache != nil {
+		length = min(length, r.cache.capacity.Load())
 	}
 	if r.isUse {
 		r.Reader.SetReadahead(length)
@@ -106,13 +109,18 @@ func (r *Reader) SetReadahead(length int64) {
 }
 
 func (r *Reader) Offset() int64 {
-	return r.offset
+	return r.offset.Load()
 }
 
 func (r *Reader) Readahead() int64 {
 	return r.readahead
 }
 
+// Rate returns bytes per second read by player
+func (r *Reader) Rate() float64 {
+	return r.rate.get()
+}
+
 func (r *Reader) Close() {
 	// file reader close in gotorrent
 	// this struct close in cache
@@ -129,11 +137,11 @@ func (r *Reader) getPiecesRange() Range {
 }
 
 func (r *Reader) getReaderPiece() int {
-	return r.getPieceNum(r.offset)
+	return r.getPieceNum(r.offset.Load())
 }
 
 func (r *Reader) getReaderRAHPiece() int {
-	return r.getPieceNum(r.offset + r.readahead)
+	return r.getPieceNum(r.offset.Load() + r.readahead)
 }
 
 func (r *Reader) getPieceNum(offset int64) int {
@@ -147,8 +155,10 @@ func (r *Reader) getOffsetRange() (int64, int64) {
 		readers = 1
 	}
 
-	beginOffset := r.offset - (r.cache.capacity/readers)*(100-prc)/100
-	endOffset := r.offset + (r.cache.capacity/readers)*prc/100
+	capacity := r.cache.capacity.Load()
+	offset := r.offset.Load()
+	beginOffset := offset - (capacity/readers)*(100-prc)/100
+	endOffset := offset + (capacity/readers)*prc/100
 
 	if beginOffset < 0 {
 		beginOffset = 0
@@ -173,7 +183,7 @@ func (r *Reader) readerOn() {
 	defer r.mu.Unlock()
 	if !r.isUse {
 		if pos, err := r.Reader.Seek(0, io.SeekCurrent); err == nil && pos == 0 {
-			r.Reader.Seek(r.offset, io.SeekStart)
+			r.Reader.Seek(r.offset.Load(), io.SeekStart)
 		}
 		r.SetReadahead(r.readahead)
 		r.isUse = true
@@ -186,7 +196,7 @@ func (r *Reader) readerOff() {
 	if r.isUse {
 		r.SetReadahead(0)
 		r.isUse = false
-		if r.offset > 0 {
+		if r.offset.Load() > 0 {
 			r.Reader.Seek(0, io.SeekStart)
 		}
 	}
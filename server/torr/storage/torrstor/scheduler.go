@@ -0,0 +1,221 @@
+package torrstor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// loadPriority mirrors piece priorities of torrent, values are equal to torrent ones
+type loadPriority int
+
+const (
+	prioNone loadPriority = iota
+	prioNormal
+	prioHigh
+	prioReadahead
+	prioNext
+	prioNow
+)
+
+const (
+	starveSeconds = 10        // reader with less buffered time is starving and gets Now/Next priorities
+	minReaderRate = 128 << 10 // bytes per second, used for readers without measured rate
+)
+
+// pieceTarget is torrent which pieces are prioritized, fake in tests
+type pieceTarget interface {
+	piecePriority(id int) loadPriority
+	setPiecePriority(id int, prio loadPriority)
+}
+
+type torrentTarget struct {
+	t *torrent.Torrent
+}
+
+func (tt torrentTarget) piecePriority(id int) loadPriority {
+	return loadPriority(tt.t.PieceState(id).Priority)
+}
+
+func (tt torrentTarget) setPiecePriority(id int, prio loadPriority) {
+	p := tt.t.Piece(id)
+	switch prio {
+	case prioNow:
+		p.SetPriority(torrent.PiecePriorityNow)
+	case prioNext:
+		p.SetPriority(torrent.PiecePriorityNext)
+	case prioReadahead:
+		p.SetPriority(torrent.PiecePriorityReadahead)
+	case prioHigh:
+		p.SetPriority(torrent.PiecePriorityHigh)
+	case prioNormal:
+		p.SetPriority(torrent.PiecePriorityNormal)
+	default:
+		p.SetPriority(torrent.PiecePriorityNone)
+	}
+}
+
+// readerStat is snapshot of reader for scheduler
+type readerStat struct {
+	target   pieceTarget
+	pos      int     // piece under reader
+	rah      int     // last piece of reader readahead
+	end      int     // last piece of reader range in cache
+	buffered int64   // loaded bytes ahead of reader without gaps
+	rate     float64 // bytes per second read by player
+}
+
+// starveTime returns seconds until player drains buffered data
+func (s *readerStat) starveTime() float64 {
+	rate := s.rate
+	if rate < minReaderRate {
+		rate = minReaderRate
+	}
+	return float64(s.buffered) / rate
+}
+
+type schedulePlan map[pieceTarget]map[int]loadPriority
+
+// set keeps highest priority of piece wanted by several readers
+func (p schedulePlan) set(target pieceTarget, id int, prio loadPriority) {
+	pieces, ok := p[target]
+	if !ok {
+		pieces = make(map[int]loadPriority)
+		p[target] = pieces
+	}
+	if prio > pieces[id] {
+		pieces[id] = prio
+	}
+}
+
+func (p schedulePlan) apply() {
+	for target, pieces := range p {
+		for id, prio := range pieces {
+			if target.piecePriority(id) != prio {
+				target.setPiecePriority(id, prio)
+			}
+		}
+	}
+}
+
+// schedule plans priorities of missing pieces in reader ranges. Budget is count of pieces loaded at once,
+// it is shared by readers weighted by time left until their buffer runs out, so reader closest to
+// starving gets the biggest part. Starving readers get Now/Next for pieces under them,
+// others are capped by Readahead so they don't take peers from starving ones.
+func schedule(readers []*readerStat, budget int, complete func(id int) bool) schedulePlan {
+	plan := make(schedulePlan)
+	if len(readers) == 0 {
+		return plan
+	}
+	sorted := append([]*readerStat(nil), readers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].starveTime() < sorted[j].starveTime()
+	})
+
+	counts := shares(sorted, budget)
+	for i, r := range sorted {
+		count := counts[i]
+		starving := r.starveTime() < starveSeconds
+		limit := 0
+		for id := r.pos; id <= r.end && limit < count; id++ {
+			if complete(id) {
+				continue
+			}
+			plan.set(r.target, id, piecePriority(r, id, starving))
+			limit++
+		}
+	}
+	return plan
+}
+
+func piecePriority(r *readerStat, id int, starving bool) loadPriority {
+	var prio loadPriority
+	switch {
+	case id == r.pos:
+		prio = prioNow
+	case id == r.pos+1:
+		prio = prioNext
+	case id <= r.rah:
+		prio = prioReadahead
+	case id <= r.rah+5:
+		prio = prioHigh
+	default:
+		prio = prioNormal
+	}
+	if !starving && prio > prioReadahead {
+		prio = prioReadahead
+	}
+	return prio
+}
+
+// shares splits budget by weights 1/(1+starveTime/starveSeconds), every reader gets at least one piece
+// and rest of budget goes to the most starving reader, readers must be sorted by starve time
+func shares(readers []*readerStat, budget int) []int {
+	ret := make([]int, len(readers))
+	if budget < len(readers) {
+		budget = len(readers)
+	}
+	weights := make([]float64, len(readers))
+	sum := 0.0
+	for i, r := range readers {
+		weights[i] = 1 / (1 + r.starveTime()/starveSeconds)
+		sum += weights[i]
+	}
+	left := budget
+	for i := range readers {
+		ret[i] = int(float64(budget) * weights[i] / sum)
+		if ret[i] < 1 {
+			ret[i] = 1
+		}
+		left -= ret[i]
+	}
+	if left > 0 {
+		ret[0] += left
+	}
+	return ret
+}
+
+// readRate measures bytes per second read from reader, smoothed over seconds
+type readRate struct {
+	rate  float64
+	bytes int64
+	start time.Time
+	mu    sync.Mutex
+}
+
+func (rr *readRate) add(n int) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if rr.start.IsZero() {
+		rr.start = time.Now()
+	}
+	rr.bytes += int64(n)
+	rr.update(time.Now())
+}
+
+// get returns smoothed rate, idle reader slowly goes to zero
+func (rr *readRate) get() float64 {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if !rr.start.IsZero() {
+		rr.update(time.Now())
+	}
+	return rr.rate
+}
+
+func (rr *readRate) update(now time.Time) {
+	elapsed := now.Sub(rr.start).Seconds()
+	if elapsed < 1 {
+		return
+	}
+	current := float64(rr.bytes) / elapsed
+	if rr.rate == 0 {
+		rr.rate = current
+	} else {
+		rr.rate = rr.rate*0.7 + current*0.3
+	}
+	rr.bytes = 0
+	rr.start = now
+}
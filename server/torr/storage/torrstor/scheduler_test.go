@@ -0,0 +1,214 @@
+package torrstor
+
+import (
+	"sort"
+	"testing"
+)
+
+const fakePieceLength = 1 << 20
+
+// fakeTorrent keeps piece priorities and loads highest priority pieces first like a swarm with limited speed
+type fakeTorrent struct {
+	complete map[int]bool
+	prio     map[int]loadPriority
+}
+
+func newFakeTorrent() *fakeTorrent {
+	return &fakeTorrent{complete: make(map[int]bool), prio: make(map[int]loadPriority)}
+}
+
+func (ft *fakeTorrent) piecePriority(id int) loadPriority {
+	return ft.prio[id]
+}
+
+func (ft *fakeTorrent) setPiecePriority(id int, prio loadPriority) {
+	ft.prio[id] = prio
+}
+
+func (ft *fakeTorrent) isComplete(id int) bool {
+	return ft.complete[id]
+}
+
+// download completes up to n wanted pieces, highest priority first
+func (ft *fakeTorrent) download(n int) {
+	var wanted []int
+	for id, prio := range ft.prio {
+		if prio > prioNone && !ft.complete[id] {
+			wanted = append(wanted, id)
+		}
+	}
+	sort.Slice(wanted, func(i, j int) bool {
+		if ft.prio[wanted[i]] != ft.prio[wanted[j]] {
+			return ft.prio[wanted[i]] > ft.prio[wanted[j]]
+		}
+		return wanted[i] < wanted[j]
+	})
+	for i := 0; i < n && i < len(wanted); i++ {
+		ft.complete[wanted[i]] = true
+		delete(ft.prio, wanted[i])
+	}
+}
+
+// fakePlayer reads file with constant bitrate
+type fakePlayer struct {
+	offset int64
+	rate   int64 // bytes per tick
+	stalls int
+}
+
+func (p *fakePlayer) stat(ft *fakeTorrent) *readerStat {
+	pos := int(p.offset / fakePieceLength)
+	st := &readerStat{
+		target: ft,
+		pos:    pos,
+		rah:    pos + 4,
+		end:    pos + 32,
+		rate:   float64(p.rate),
+	}
+	offset := p.offset
+	for id := pos; id <= st.end && ft.complete[id]; id++ {
+		st.buffered += int64(id+1)*fakePieceLength - offset
+		offset = int64(id+1) * fakePieceLength
+	}
+	return st
+}
+
+// play consumes one tick of data, counts stall if data under player is not loaded
+func (p *fakePlayer) play(ft *fakeTorrent) {
+	left := p.rate
+	for left > 0 {
+		id := int(p.offset / fakePieceLength)
+		if !ft.complete[id] {
+			p.stalls++
+			return
+		}
+		n := min(left, int64(id+1)*fakePieceLength-p.offset)
+		p.offset += n
+		left -= n
+	}
+}
+
+func TestScheduleStarvingReaderFirst(t *testing.T) {
+	ft := newFakeTorrent()
+	for id := 500; id < 520; id++ {
+		ft.complete[id] = true
+	}
+	starving := &readerStat{target: ft, pos: 100, rah: 104, end: 130, rate: 2 << 20}
+	comfortable := &readerStat{target: ft, pos: 500, rah: 504, end: 530, rate: 1 << 20, buffered: 20 << 20}
+
+	plan := schedule([]*readerStat{comfortable, starving}, 10, ft.isComplete)
+	pieces := plan[ft]
+
+	if pieces[100] != prioNow || pieces[101] != prioNext {
+		t.Errorf("starving reader got %v/%v, want Now/Next", pieces[100], pieces[101])
+	}
+	var starvingCount, comfortableCount int
+	for id, prio := range pieces {
+		if id >= 500 {
+			comfortableCount++
+			if prio > prioReadahead {
+				t.Errorf("comfortable reader piece %d got %v, want at most Readahead", id, prio)
+			}
+		} else {
+			starvingCount++
+		}
+	}
+	if starvingCount <= comfortableCount {
+		t.Errorf("starving reader got %d pieces, comfortable %d", starvingCount, comfortableCount)
+	}
+	if comfortableCount == 0 {
+		t.Error("comfortable reader got no pieces")
+	}
+}
+
+func TestScheduleUsesReadRate(t *testing.T) {
+	ft := newFakeTorrent()
+	// bigger buffer, but first reader drains it eight times faster
+	fast := &readerStat{target: ft, pos: 10, rah: 14, end: 40, rate: 8 << 20, buffered: 24 << 20}
+	slow := &readerStat{target: ft, pos: 200, rah: 204, end: 230, rate: 1 << 20, buffered: 16 << 20}
+
+	counts := shares([]*readerStat{fast, slow}, 12)
+	if counts[0] <= counts[1] {
+		t.Errorf("fast reader share %d, slow reader share %d", counts[0], counts[1])
+	}
+	plan := schedule([]*readerStat{slow, fast}, 12, ft.isComplete)
+	if plan[ft][10] != prioNow {
+		t.Errorf("fast reader piece priority %v, want Now", plan[ft][10])
+	}
+	if plan[ft][200] != prioReadahead {
+		t.Errorf("slow reader piece priority %v, want Readahead", plan[ft][200])
+	}
+}
+
+func TestScheduleSharedPieceKeepsHighest(t *testing.T) {
+	ft := newFakeTorrent()
+	a := &readerStat{target: ft, pos: 50, rah: 54, end: 80, buffered: 40 << 20}
+	b := &readerStat{target: ft, pos: 50, rah: 54, end: 80}
+
+	plan := schedule([]*readerStat{a, b}, 8, ft.isComplete)
+	if plan[ft][50] != prioNow {
+		t.Errorf("shared piece priority %v, want Now", plan[ft][50])
+	}
+}
+
+func TestScheduleBudget(t *testing.T) {
+	ft := newFakeTorrent()
+	readers := []*readerStat{
+		{target: ft, pos: 0, rah: 4, end: 100},
+		{target: ft, pos: 200, rah: 204, end: 300, buffered: 4 << 20},
+		{target: ft, pos: 400, rah: 404, end: 500, buffered: 64 << 20},
+	}
+	plan := schedule(readers, 9, ft.isComplete)
+	if n := len(plan[ft]); n != 9 {
+		t.Errorf("planned %d pieces, want budget 9", n)
+	}
+	for _, r := range readers {
+		if _, ok := plan[ft][r.pos]; !ok {
+			t.Errorf("reader at %d got no pieces", r.pos)
+		}
+	}
+}
+
+// TestScheduleNoStarvation plays two files with different bitrates from one torrent,
+// swarm speed is enough for both, after start no player should stall
+func TestScheduleNoStarvation(t *testing.T) {
+	ft := newFakeTorrent()
+	players := []*fakePlayer{
+		{offset: 100 * fakePieceLength, rate: 3 << 20},
+		{offset: 600 * fakePieceLength, rate: 1 << 19},
+	}
+	const warmup, ticks = 5, 300
+	for tick := 0; tick < ticks; tick++ {
+		readers := make([]*readerStat, 0, len(players))
+		for _, p := range players {
+			readers = append(readers, p.stat(ft))
+		}
+		schedule(readers, 6, ft.isComplete).apply()
+		ft.download(5)
+		if tick == warmup {
+			for _, p := range players {
+				p.stalls = 0
+			}
+		}
+		for _, p := range players {
+			p.play(ft)
+		}
+	}
+	for i, p := range players {
+		if p.stalls > 0 {
+			t.Errorf("player %d stalled %d times", i, p.stalls)
+		}
+	}
+}
+
+func TestShares(t *testing.T) {
+	readers := []*readerStat{{}, {buffered: 100 << 20, rate: 1 << 20}}
+	counts := shares(readers, 1)
+	if counts[0] < 1 || counts[1] < 1 {
+		t.Errorf("every reader must get a piece, got %v", counts)
+	}
+	counts = shares(readers, 20)
+	if counts[0]+counts[1] != 20 {
+		t.Errorf("shares %v don't use budget 20", counts)
+	}
+}
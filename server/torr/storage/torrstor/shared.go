@@ -0,0 +1,84 @@
+package torrstor
+
+import (
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	ts "github.com/anacrolix/torrent/storage"
+)
+
+// caches shared between storages of different users
+var (
+	sharedCaches = make(map[metainfo.Hash]*sharedCache)
+	muShared     sync.Mutex
+)
+
+// sharedCache is sized by the largest capacity of storages referencing it, so quota of
+// each user is applied against this shared capacity, not against own CacheSize
+type sharedCache struct {
+	cache    *Cache
+	storages []*Storage // one entry per reference, first is owner of cache
+}
+
+// resize sets cache capacity to max capacity of referencing storages
+func (sc *sharedCache) resize() {
+	var capacity int64
+	for _, s := range sc.storages {
+		capacity = max(capacity, s.capacity)
+	}
+	if capacity > 0 {
+		sc.cache.capacity.Store(capacity)
+	}
+}
+
+// cacheRef is the storage handle of shared cache, closing it releases one reference
+type cacheRef struct {
+	*Cache
+	storage *Storage
+}
+
+func (r *cacheRef) Close() error {
+	r.storage.CloseHash(r.hash)
+	return nil
+}
+
+var _ ts.TorrentImpl = (*cacheRef)(nil)
+
+func openSharedCache(info *metainfo.Info, hash metainfo.Hash, s *Storage) *Cache {
+	muShared.Lock()
+	defer muShared.Unlock()
+	if sc, ok := sharedCaches[hash]; ok && !sc.cache.isClosed.Load() {
+		sc.storages = append(sc.storages, s)
+		sc.resize()
+		return sc.cache
+	}
+	ch := NewCache(s.capacity, s)
+	ch.shared = true
+	ch.Init(info, hash)
+	sharedCaches[hash] = &sharedCache{cache: ch, storages: []*Storage{s}}
+	return ch
+}
+
+// releaseSharedCache drops reference of storage and returns true if cache is not used anymore
+// and must be closed, otherwise cache is moved to next storage and resized by remaining ones
+func releaseSharedCache(ch *Cache, s *Storage) bool {
+	muShared.Lock()
+	defer muShared.Unlock()
+	sc, ok := sharedCaches[ch.hash]
+	if !ok || sc.cache != ch {
+		return true
+	}
+	for i, stor := range sc.storages {
+		if stor == s {
+			sc.storages = append(sc.storages[:i], sc.storages[i+1:]...)
+			break
+		}
+	}
+	if len(sc.storages) > 0 {
+		ch.storage = sc.storages[0]
+		sc.resize()
+		return false
+	}
+	delete(sharedCaches, ch.hash)
+	return true
+}
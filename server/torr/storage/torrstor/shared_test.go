@@ -0,0 +1,62 @@
+package torrstor
+
+import (
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"server/settings"
+)
+
+func TestSharedCacheCapacity(t *testing.T) {
+	old := settings.BTsets
+	settings.BTsets = &settings.BTSets{}
+	t.Cleanup(func() { settings.BTsets = old })
+
+	const pieceLength = 1 << 20
+	info := &metainfo.Info{Name: "file", Length: 4 * pieceLength, PieceLength: pieceLength, Pieces: make([]byte, 4*20)}
+	hash := infoHash(t, info)
+
+	big := NewStorage(64<<20, true)
+	small := NewStorage(16<<20, true)
+	if _, err := small.OpenTorrent(info, hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := big.OpenTorrent(info, hash); err != nil {
+		t.Fatal(err)
+	}
+	c := small.GetCache(hash)
+	if c != big.GetCache(hash) {
+		t.Fatal("cache is not shared")
+	}
+	if got := c.GetCapacity(); got != 64<<20 {
+		t.Errorf("capacity %d, want max of storages %d", got, 64<<20)
+	}
+
+	small.CloseHash(hash)
+	if c.isClosed.Load() {
+		t.Fatal("cache closed while referenced")
+	}
+	if c.storage != big {
+		t.Error("cache is not moved to remaining storage")
+	}
+	if got := c.GetCapacity(); got != 64<<20 {
+		t.Errorf("capacity %d, want %d", got, 64<<20)
+	}
+
+	if _, err := small.OpenTorrent(info, hash); err != nil {
+		t.Fatal(err)
+	}
+	big.CloseHash(hash)
+	if c.storage != small {
+		t.Error("cache is not moved to remaining storage")
+	}
+	if got := c.GetCapacity(); got != 16<<20 {
+		t.Errorf("capacity %d after release of bigger storage, want %d", got, 16<<20)
+	}
+
+	small.CloseHash(hash)
+	if !c.isClosed.Load() {
+		t.Error("cache is not closed after last release")
+	}
+}
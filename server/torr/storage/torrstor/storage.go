@@ -14,12 +14,15 @@ type Storage struct {
 
 	caches   map[metainfo.Hash]*Cache
 	capacity int64
+	shared   bool
 	mu       sync.Mutex
 }
 
-func NewStorage(capacity int64) *Storage {
+// NewStorage creates storage, in shared mode caches of same torrent are shared with other storages
+func NewStorage(capacity int64, shared bool) *Storage {
 	stor := new(Storage)
 	stor.capacity = capacity
+	stor.shared = shared
 	stor.caches = make(map[metainfo.Hash]*Cache)
 	return stor
 }
@@ -30,6 +33,11 @@ func (s *Storage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (ts.T
 	// } //	NE
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.shared {
+		ch := openSharedCache(info, infoHash, s)
+		s.caches[infoHash] = ch
+		return &cacheRef{Cache: ch, storage: s}, nil
+	}
 	ch := NewCache(s.capacity, s)
 	ch.Init(info, infoHash)
 	s.caches[infoHash] = ch
@@ -48,20 +56,28 @@ func (s *Storage) CloseHash(hash metainfo.Hash) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if ch, ok := s.caches[hash]; ok {
-		ch.Close()
 		delete(s.caches, hash)
+		s.closeCache(ch)
 	}
 }
 
 func (s *Storage) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	for _, ch := range s.caches {
-		ch.Close()
+	for hash, ch := range s.caches {
+		delete(s.caches, hash)
+		s.closeCache(ch)
 	}
 	return nil
 }
 
+func (s *Storage) closeCache(ch *Cache) {
+	if ch.shared && !releaseSharedCache(ch, s) {
+		return
+	}
+	ch.Close()
+}
+
 func (s *Storage) GetCache(hash metainfo.Hash) *Cache {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -15,8 +15,35 @@ import (
 	mt "server/mimetype"
 	sets "server/settings"
 	"server/torr/state"
+	"server/torr/storage/torrstor"
 )
 
+// OpenReader opens cache reader of file with id for readers other than http stream, like webdav,
+// size limit and readers quota are checked as for stream
+func (t *Torrent) OpenReader(fileID int) (*torrstor.Reader, *torrent.File, error) {
+	if !t.GotInfo() {
+		return nil, nil, errors.New("torrent don't get info")
+	}
+	file := t.findFileIndex(fileID)
+	if file == nil {
+		return nil, nil, fmt.Errorf("file with id %v not found", fileID)
+	}
+	if int64(sets.MaxSize) > 0 && file.Length() > int64(sets.MaxSize) {
+		return nil, nil, fmt.Errorf("file size exceeded max allowed %d bytes", sets.MaxSize)
+	}
+	if err := t.bt.checkReadersQuota(); err != nil {
+		return nil, nil, err
+	}
+	reader := t.NewReader(file)
+	if reader == nil {
+		return nil, nil, errors.New("torrent closed")
+	}
+	if t.bt.Settings().ResponsiveMode {
+		reader.SetResponsive()
+	}
+	return reader, file, nil
+}
+
 func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter, user string) error {
 	if !t.GotInfo() {
 		http.NotFound(resp, req)
@@ -54,8 +81,14 @@ func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter
 		return err
 	}
 
+	if err := t.bt.checkReadersQuota(); err != nil {
+		log.Println("stream", user, file.DisplayPath(), err)
+		http.Error(resp, err.Error(), QuotaStatus(err))
+		return err
+	}
+
 	reader := t.NewReader(file)
-	if sets.BTsets.ResponsiveMode {
+	if t.bt.Settings().ResponsiveMode {
 		reader.SetResponsive()
 	}
 
@@ -78,6 +111,10 @@ func (t *Torrent) Stream(fileID int, req *http.Request, resp http.ResponseWriter
 		resp.Header().Set("content-type", mime.String())
 	}
 
+	t.bt.streams.Add(1)
+	t.bt.streamsTotal.Add(1)
+	// panic of ServeContent (ErrAbortHandler) must not leave stream active
+	defer t.bt.streams.Add(-1)
 	http.ServeContent(resp, req, file.Path(), time.Unix(t.Timestamp, 0), reader)
 
 	t.CloseReader(reader)
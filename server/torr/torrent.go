@@ -4,6 +4,7 @@ import (
 	"errors"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	utils2 "server/utils"
@@ -48,7 +49,12 @@ type Torrent struct {
 	DurationSeconds float64
 	BitRate         string
 
+	media   map[string]*state.MediaInfo
+	muMedia sync.Mutex
+	muProbe sync.Mutex
+
 	expiredTime time.Time
+	downloading atomic.Bool // not complete files of download are stored in db
 
 	closed <-chan struct{}
 
@@ -60,7 +66,10 @@ func NewTorrent(spec *torrent.TorrentSpec, bt *BTServer) (*Torrent, error) {
 	if bt == nil || bt.client == nil {
 		return nil, errors.New("BT client not connected")
 	}
-	switch settings.BTsets.RetrackersMode {
+	if err := bt.checkTorrentsQuota(spec.InfoHash); err != nil {
+		return nil, err
+	}
+	switch bt.Settings().RetrackersMode {
 	case 1:
 		spec.Trackers = append(spec.Trackers, [][]string{utils.GetDefTrackers()}...)
 	case 2:
@@ -201,6 +210,7 @@ func (t *Torrent) progressEvent() {
 
 	t.lastTimeSpeed = time.Now()
 	t.updateRA()
+	t.checkDownload()
 }
 
 func (t *Torrent) updateRA() {
@@ -217,12 +227,11 @@ func (t *Torrent) updateRA() {
 	// 	}
 	// 	go t.cache.AdjustRA(adj)
 	// }
-	adj := int64(16 << 20) // 16 MB fixed RA
-	go t.cache.AdjustRA(adj)
+	go t.cache.AdjustRA(t.bitrate)
 }
 
 func (t *Torrent) expired() bool {
-	return t.cache.Readers() == 0 && t.expiredTime.Before(time.Now()) && (t.Stat == state.TorrentWorking || t.Stat == state.TorrentClosed)
+	return t.cache.Readers() == 0 && !t.cache.Downloading() && t.expiredTime.Before(time.Now()) && (t.Stat == state.TorrentWorking || t.Stat == state.TorrentClosed)
 }
 
 func (t *Torrent) Files() []*torrent.File {
@@ -350,8 +359,10 @@ func (t *Torrent) Status() *state.TorrentStatus {
 					Id:     i + 1, // in web id 0 is undefined
 					Path:   f.Path(),
 					Length: f.Length(),
+					Media:  t.MediaInfo(f.Path()),
 				})
 			}
+			st.Downloads = t.cache.DownloadState()
 		}
 	}
 
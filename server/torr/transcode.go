@@ -0,0 +1,41 @@
+package torr
+
+import (
+	"strconv"
+
+	"server/settings"
+	"server/web/auth"
+)
+
+// LocalPlayLink returns /play link of file for local ffprobe and ffmpeg, signed for user when auth enabled
+func LocalPlayLink(user, hash string, index int) string {
+	path := "/play/" + hash
+	if settings.HttpAuth {
+		path += ":" + user
+	}
+	path += "/" + strconv.Itoa(index)
+	if settings.HttpAuth {
+		path += "?token=" + auth.StreamToken(user, hash)
+	}
+	if settings.Ssl {
+		return "https://127.0.0.1:" + settings.SslPort + path
+	}
+	return "http://127.0.0.1:" + settings.Port + path
+}
+
+// AcquireTranscode reserves transcode slot of user checking MaxTranscodes quota, release frees the slot
+func AcquireTranscode(user string) (release func(), err error) {
+	bt := getOrCreateServer(user)
+	quota := userQuota(bt.user)
+	bt.muTranscodes.Lock()
+	defer bt.muTranscodes.Unlock()
+	if err = checkQuota("transcodes", bt.transcodes, quota.MaxTranscodes); err != nil {
+		return nil, err
+	}
+	bt.transcodes++
+	return func() {
+		bt.muTranscodes.Lock()
+		bt.transcodes--
+		bt.muTranscodes.Unlock()
+	}, nil
+}
@@ -99,3 +99,13 @@ func Limit(i int) *rate.Limiter {
 	}
 	return l
 }
+
+// SetLimit changes limiter made by Limit to rate i, i <= 0 removes limit
+func SetLimit(l *rate.Limiter, i int) {
+	if i <= 0 {
+		l.SetLimit(rate.Inf)
+		return
+	}
+	l.SetBurst(max(i, 16*1024))
+	l.SetLimit(rate.Limit(i))
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+var extSubtitle = map[string]interface{}{
+	".ass": nil,
+	".smi": nil,
+	".srt": nil,
+	".ssa": nil,
+	".sub": nil,
+	".vtt": nil,
+}
+
+func IsSubtitle(filename string) bool {
+	_, ok := extSubtitle[strings.ToLower(filepath.Ext(filename))]
+	return ok
+}
+
+// SubtitleLang returns language or title part of subtitle name after video name:
+// Movie.mkv, Subs/Movie.rus.srt -> rus
+func SubtitleLang(video, sub string) string {
+	name := strings.TrimSuffix(filepath.Base(video), filepath.Ext(video))
+	lang := strings.TrimSuffix(filepath.Base(sub), filepath.Ext(sub))
+	if i := strings.Index(lang, name); i != -1 {
+		lang = lang[i+len(name):]
+	}
+	return strings.Trim(lang, " ._-[]()")
+}
+
+// SrtToVtt converts SubRip subtitles to WebVTT, not UTF-8 text is decoded as Windows-1251
+func SrtToVtt(r io.Reader, w io.Writer) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	buf = bytes.TrimPrefix(buf, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(buf) {
+		if buf, err = charmap.Windows1251.NewDecoder().Bytes(buf); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+	sc := bufio.NewScanner(bytes.NewReader(buf))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.Contains(line, "-->") {
+			// 00:00:01,000 --> 00:00:02,500
+			line = strings.ReplaceAll(line, ",", ".")
+		}
+		bw.WriteString(line + "\n")
+	}
+	if err = sc.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
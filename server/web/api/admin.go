@@ -0,0 +1,239 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"server/log"
+	sets "server/settings"
+	"server/torr"
+	"server/web/auth"
+)
+
+// Action: list, add, rem, set, disable, enable, quota, sets
+type usersReqJS struct {
+	requestI
+	User     string           `json:"user,omitempty"`
+	Password string           `json:"password,omitempty"`
+	Role     string           `json:"role,omitempty"`
+	Quota    *sets.UserQuota  `json:"quota,omitempty"`
+	Sets     *sets.UserBTSets `json:"sets,omitempty"`
+}
+
+// applyJS tells how settings change was applied: live - in running servers, restart - servers were reconnected
+type applyJS struct {
+	Apply string `json:"apply"`
+}
+
+type userJS struct {
+	User     string `json:"user"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled,omitempty"`
+	File     bool   `json:"file,omitempty"` // defined only in accs.db
+}
+
+// adminUsers godoc
+//
+//	@Summary		Manage accounts
+//	@Description	Allow admin to list, add, remove, disable, enable accounts and to change password, role, quota and settings of account. Actions quota and sets answer {"apply": "live"} if changes were applied to running server or {"apply": "restart"} if server was reconnected.
+//
+//	@Tags			API
+//
+//	@Param			request	body	usersReqJS	true	"Users request. Available params for action: list, add, rem, set, disable, enable, quota, sets. user required for all actions except list, password required for add."
+//
+//	@Accept			json
+//	@Produce		json
+//	@Success		200
+//	@Router			/admin/users [post]
+func adminUsers(c *gin.Context) {
+	var req usersReqJS
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if req.Action != "list" && req.User == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("user is empty"))
+		return
+	}
+	if req.Role != "" && req.Role != sets.RoleUser && req.Role != sets.RoleAdmin {
+		c.AbortWithError(http.StatusBadRequest, errors.New("wrong role"))
+		return
+	}
+	if req.Action != "list" && sets.ReadOnly {
+		c.AbortWithError(http.StatusForbidden, errors.New("read-only DB mode"))
+		return
+	}
+	c.Status(http.StatusBadRequest)
+	switch req.Action {
+	case "list":
+		{
+			listUsers(c)
+		}
+	case "add":
+		{
+			addUser(req, c)
+		}
+	case "rem":
+		{
+			remUser(req, c)
+		}
+	case "set":
+		{
+			setUser(req, c)
+		}
+	case "disable":
+		{
+			disableUser(req, c, true)
+		}
+	case "enable":
+		{
+			disableUser(req, c, false)
+		}
+	case "quota":
+		{
+			c.JSON(200, applyJS{Apply: torr.SetUserQuota(req.User, req.Quota)})
+		}
+	case "sets":
+		{
+			c.JSON(200, applyJS{Apply: torr.SetUserSettings(req.User, req.Sets)})
+		}
+	}
+}
+
+func listUsers(c *gin.Context) {
+	accs := auth.Accounts()
+	list := make([]userJS, 0, len(accs))
+	for user, acc := range accs {
+		list = append(list, userJS{
+			User:     user,
+			Role:     acc.Role,
+			Disabled: acc.Disabled,
+			File:     sets.GetAccount(user) == nil,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].User < list[j].User
+	})
+	c.JSON(200, list)
+}
+
+func addUser(req usersReqJS, c *gin.Context) {
+	if req.Password == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("password is empty"))
+		return
+	}
+	if _, ok := auth.Accounts()[req.User]; ok {
+		c.AbortWithError(http.StatusConflict, errors.New("user already exists"))
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	sets.SetAccount(req.User, &sets.Account{Password: hash, Role: req.Role})
+	auth.Reload()
+	log.TLogln("Account added", req.User)
+	if _, err = torr.ConnectServer(req.User); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(200)
+}
+
+func remUser(req usersReqJS, c *gin.Context) {
+	if sets.GetAccount(req.User) == nil {
+		if auth.FileAccount(req.User) {
+			c.AbortWithError(http.StatusConflict, errors.New("user defined in accs.db, disable it instead"))
+			return
+		}
+		c.AbortWithError(http.StatusNotFound, errors.New("user not found"))
+		return
+	}
+	if !auth.KeepsAdmin(req.User, nil) {
+		c.AbortWithError(http.StatusConflict, errors.New("last enabled admin can't be removed, disabled or demoted"))
+		return
+	}
+	sets.RemAccount(req.User)
+	auth.Reload()
+	log.TLogln("Account removed", req.User)
+	if auth.FileAccount(req.User) {
+		// account from accs.db is active again
+		c.Status(200)
+		return
+	}
+	torr.DisconnectServer(req.User)
+	c.Status(200)
+}
+
+// setUser changes password and/or role, accounts from accs.db are copied to settings db
+func setUser(req usersReqJS, c *gin.Context) {
+	acc, ok := auth.Accounts()[req.User]
+	if !ok {
+		c.AbortWithError(http.StatusNotFound, errors.New("user not found"))
+		return
+	}
+	if req.Password != "" {
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		acc.Password = hash
+	}
+	if req.Role != "" {
+		acc.Role = req.Role
+	}
+	if !auth.KeepsAdmin(req.User, &acc) {
+		c.AbortWithError(http.StatusConflict, errors.New("last enabled admin can't be removed, disabled or demoted"))
+		return
+	}
+	sets.SetAccount(req.User, &acc)
+	auth.Reload()
+	log.TLogln("Account changed", req.User)
+	c.Status(200)
+}
+
+func disableUser(req usersReqJS, c *gin.Context, disabled bool) {
+	acc, ok := auth.Accounts()[req.User]
+	if !ok {
+		c.AbortWithError(http.StatusNotFound, errors.New("user not found"))
+		return
+	}
+	acc.Disabled = disabled
+	if !auth.KeepsAdmin(req.User, &acc) {
+		c.AbortWithError(http.StatusConflict, errors.New("last enabled admin can't be removed, disabled or demoted"))
+		return
+	}
+	sets.SetAccount(req.User, &acc)
+	auth.Reload()
+	if disabled {
+		log.TLogln("Account disabled", req.User)
+		torr.DisconnectServer(req.User)
+	} else {
+		log.TLogln("Account enabled", req.User)
+		if _, err := torr.ConnectServer(req.User); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	c.Status(200)
+}
+
+// adminStatus godoc
+//
+//	@Summary		Status of all users
+//	@Description	Return state of torrent servers of all users: connection, last use, idle evictions, torrents, readers, cache and speeds.
+//
+//	@Tags			API
+//
+//	@Produce		json
+//	@Success		200	{array}	state.ServerStatus	"Servers status"
+//	@Router			/admin/status [get]
+func adminStatus(c *gin.Context) {
+	c.JSON(200, torr.ListServersStatus(auth.Users()...))
+}
@@ -3,23 +3,27 @@ package api
 import (
 	"net/http"
 
+	sets "server/settings"
 	"server/torr"
+	"server/torr/storage/torrstor"
 	"server/web/api/utils"
+	"server/web/auth"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 )
 
-// Action: get
+// Action: get, disk, trim
 type cacheReqJS struct {
 	requestI
 	Hash string `json:"hash,omitempty"`
+	Size int64  `json:"size,omitempty"` // trim: target size of disk cache, DiskCacheSize if empty
 }
 
 // cache godoc
 //
 //	@Summary		Return cache stats
-//	@Description	Return cache stats.
+//	@Description	Return cache stats of torrent, disk cache usage of all torrents or trim disk cache.
 //
 //	@Tags			API
 //
@@ -41,7 +45,36 @@ func cache(c *gin.Context) {
 		{
 			getCache(req, c)
 		}
+	case "disk":
+		{
+			c.JSON(200, torrstor.DiskCache())
+		}
+	case "trim":
+		{
+			trimCache(req, c)
+		}
+	}
+}
+
+func trimCache(req cacheReqJS, c *gin.Context) {
+	// disk cache is common for all users
+	if sets.HttpAuth && !auth.IsAdmin(c.GetString(gin.AuthUserKey)) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if !sets.BTsets.UseDisk {
+		c.AbortWithError(http.StatusBadRequest, errors.New("disk cache is disabled"))
+		return
+	}
+	size := req.Size
+	if size <= 0 {
+		size = sets.BTsets.DiskCacheSize
+	}
+	if size <= 0 {
+		c.AbortWithError(http.StatusBadRequest, errors.New("size of disk cache is not set"))
+		return
 	}
+	c.JSON(200, torrstor.TrimDiskCache(size))
 }
 
 func getCache(req cacheReqJS, c *gin.Context) {
@@ -65,6 +98,7 @@ func getCache(req cacheReqJS, c *gin.Context) {
 		} else {
 			st.Hash = utils.JoinHashUser(st.Hash, reqUser)
 			if st.Torrent != nil {
+				st.Torrent.Token = utils.StreamToken(st.Torrent.Hash, reqUser)
 				st.Torrent.Hash = utils.JoinHashUser(st.Torrent.Hash, reqUser)
 			}
 			c.JSON(200, st)
@@ -1,20 +1,18 @@
 package api
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
 
-	"server/ffprobe"
-	sets "server/settings"
-
 	"github.com/gin-gonic/gin"
+
+	"server/torr"
 )
 
 // ffp godoc
 //
 //	@Summary		Gather informations using ffprobe
-//	@Description	Gather informations using ffprobe.
+//	@Description	Gather informations using ffprobe. Summary of result is stored in torrent db and returned in file_stats of torrent status, next requests return stored summary in ffprobe layout without new probe.
 //
 //	@Tags			API
 //
@@ -25,24 +23,17 @@ import (
 //	@Success		200	"Data returned from ffprobe"
 //	@Router			/ffp/{hash}/{id} [get]
 func ffp(c *gin.Context) {
-	hash := c.Param("hash")
-	indexStr := c.Param("id")
-
-	if hash == "" || indexStr == "" {
-		c.AbortWithError(http.StatusNotFound, errors.New("link should not be empty"))
+	tor, _, index, ok := torrentFile(c, c.Param("hash"), c.Param("id"))
+	if !ok {
 		return
 	}
 
-	link := "http://127.0.0.1:" + sets.Port + "/play/" + hash + "/" + indexStr
-	if sets.Ssl {
-		link = "https://127.0.0.1:" + sets.SslPort + "/play/" + hash + "/" + indexStr
-	}
-
-	data, err := ffprobe.ProbeUrl(link)
+	// ffprobe runs only for files without stored media info
+	info, err := tor.Probe(index)
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("error getting data: %v", err))
 		return
 	}
 
-	c.JSON(200, data)
+	c.JSON(200, torr.ProbeData(info))
 }
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"server/ffmpeg"
+	"server/log"
+	"server/torr"
+	"server/torr/state"
+	"server/web/api/utils"
+)
+
+const (
+	hlsSegmentDuration = 6 // in seconds
+	hlsIdleTimeout     = time.Minute
+	hlsWaitTimeout     = 30 * time.Second
+)
+
+var hlsAudio = regexp.MustCompile(`^(\d+|all)$`)
+
+// hlsSession is ffmpeg process of one viewer cutting file to segments in temp dir,
+// it is stopped and removed when player doesn't request it for hlsIdleTimeout
+type hlsSession struct {
+	dir    string
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	access atomic.Int64
+}
+
+var (
+	hlsSessions   = make(map[string]*hlsSession)
+	muHlsSessions sync.Mutex
+)
+
+// hls godoc
+//
+//	@Summary		HLS stream of torrent file
+//	@Description	Return HLS playlist or MPEG-TS segment of file cut by ffmpeg. Streams are copied, profile encodes them like /stream with profile. Segments are read through /play, so loading of file follows cache priorities.
+//
+//	@Tags			API
+//
+//	@Param			hash	path	string	true	"Torrent hash"
+//	@Param			id		path	string	true	"File index in torrent"
+//	@Param			name	path	string	true	"index.m3u8 or segment name like 0.ts"
+//	@Param			profile	query	string	false	"Transcode profile: 480p, 720p, 1080p"
+//	@Param			audio	query	string	false	"Number of audio track from 0 or all, def 0"
+//
+//	@Produce		application/vnd.apple.mpegurl
+//	@Success		200	"Playlist or segment"
+//	@Router			/hls/{hash}/{id}/{name} [get]
+func hls(c *gin.Context) {
+	hash := c.Param("hash")
+	indexStr := c.Param("id")
+	name := c.Param("name")
+
+	if !ffmpeg.Exists() {
+		c.AbortWithError(http.StatusNotImplemented, errors.New("ffmpeg not found"))
+		return
+	}
+
+	var profile *ffmpeg.Profile
+	if name := c.Query("profile"); name != "" {
+		p, ok := ffmpeg.Profiles[name]
+		if !ok {
+			c.AbortWithError(http.StatusBadRequest, errors.New("unknown profile"))
+			return
+		}
+		profile = &p
+	}
+	audio := c.DefaultQuery("audio", "0")
+	if !hlsAudio.MatchString(audio) {
+		c.AbortWithError(http.StatusBadRequest, errors.New("wrong audio"))
+		return
+	}
+
+	tor, user, index, ok := torrentFile(c, hash, indexStr)
+	if !ok {
+		return
+	}
+
+	hash = tor.Hash().HexString()
+	key := strings.Join([]string{user, hash, strconv.Itoa(index), c.Query("profile"), audio}, "/")
+	if name == "index.m3u8" {
+		link := torr.LocalPlayLink(user, hash, index)
+		sess, err := startHlsSession(key, user, link, audio, profile)
+		if err != nil {
+			c.AbortWithError(errStatus(err), err)
+			return
+		}
+		hlsPlaylist(c, sess, hash, user)
+		return
+	}
+	muHlsSessions.Lock()
+	sess := hlsSessions[key]
+	muHlsSessions.Unlock()
+	if sess == nil {
+		// session is stopped, player has to reload playlist
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	hlsSegment(c, sess, name)
+}
+
+// torrentFile resolves user and loads torrent with file index for file endpoints, aborts request on error
+func torrentFile(c *gin.Context, hash, indexStr string) (tor *torr.Torrent, user string, index int, ok bool) {
+	hash, user, ok = utils.ResolveHashUser(c, hash, utils.UserID(c))
+	if !ok {
+		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, "", 0, false
+	}
+
+	tor = torr.GetTorrent(user, hash)
+	if tor == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, "", 0, false
+	}
+	if tor.Stat == state.TorrentInDB {
+		tor = torr.LoadTorrent(user, tor)
+		if tor == nil {
+			c.AbortWithError(http.StatusInternalServerError, errors.New("error get torrent info"))
+			return nil, "", 0, false
+		}
+	}
+	if !tor.GotInfo() {
+		c.AbortWithError(http.StatusInternalServerError, errors.New("timeout connection torrent"))
+		return nil, "", 0, false
+	}
+
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 1 || index > len(tor.Files()) {
+		c.AbortWithError(http.StatusBadRequest, errors.New("\"index\" is wrong"))
+		return nil, "", 0, false
+	}
+	return tor, user, index, true
+}
+
+// startHlsSession returns running session of key or starts ffmpeg, session takes transcode slot of user
+func startHlsSession(key, user, link, audio string, profile *ffmpeg.Profile) (*hlsSession, error) {
+	muHlsSessions.Lock()
+	defer muHlsSessions.Unlock()
+	if sess, ok := hlsSessions[key]; ok {
+		sess.access.Store(time.Now().Unix())
+		return sess, nil
+	}
+
+	release, err := torr.AcquireTranscode(user)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "hls-")
+	if err != nil {
+		release()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sess := &hlsSession{dir: dir, cancel: cancel, done: make(chan struct{})}
+	sess.access.Store(time.Now().Unix())
+	hlsSessions[key] = sess
+
+	log.TLogln("Start hls", key)
+	go func() {
+		sess.err = ffmpeg.HLS(ctx, link, dir, hlsSegmentDuration, audio, profile)
+		if sess.err != nil && ctx.Err() == nil {
+			log.TLogln("Error hls", key, sess.err)
+		}
+		close(sess.done)
+	}()
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if time.Since(time.Unix(sess.access.Load(), 0)) > hlsIdleTimeout {
+				break
+			}
+		}
+		muHlsSessions.Lock()
+		delete(hlsSessions, key)
+		muHlsSessions.Unlock()
+		cancel()
+		<-sess.done
+		os.RemoveAll(dir)
+		release()
+		log.TLogln("Stop hls", key)
+	}()
+	return sess, nil
+}
+
+// wait returns true when file of session exists, false if ffmpeg is finished without it or timeout
+func (s *hlsSession) wait(name string) bool {
+	deadline := time.Now().Add(hlsWaitTimeout)
+	for {
+		s.access.Store(time.Now().Unix())
+		if _, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+			return true
+		}
+		select {
+		case <-s.done:
+			_, err := os.Stat(filepath.Join(s.dir, name))
+			return err == nil
+		case <-time.After(200 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+	}
+}
+
+// hlsPlaylist returns playlist written by ffmpeg, segment links keep token, profile and audio of request
+func hlsPlaylist(c *gin.Context, sess *hlsSession, hash, user string) {
+	if !sess.wait("index.m3u8") {
+		err := errors.New("timeout of hls playlist")
+		select {
+		case <-sess.done:
+			if sess.err != nil {
+				err = sess.err
+			}
+		default:
+		}
+		c.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+	buf, err := os.ReadFile(filepath.Join(sess.dir, "index.m3u8"))
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	query := url.Values{}
+	for _, k := range []string{"profile", "audio"} {
+		if v := c.Query(k); v != "" {
+			query.Set(k, v)
+		}
+	}
+	if token := utils.StreamToken(hash, user); token != "" {
+		query.Set("token", token)
+	}
+	suffix := ""
+	if len(query) > 0 {
+		suffix = "?" + query.Encode()
+	}
+	var sb strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" && !strings.HasPrefix(line, "#") {
+			line += suffix
+		}
+		sb.WriteString(line + "\n")
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Data(200, "application/vnd.apple.mpegurl", []byte(sb.String()))
+}
+
+func hlsSegment(c *gin.Context, sess *hlsSession, name string) {
+	num, err := strconv.Atoi(strings.TrimSuffix(name, ".ts"))
+	if err != nil || num < 0 || !strings.HasSuffix(name, ".ts") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if !sess.wait(strconv.Itoa(num) + ".ts") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Header("Content-Type", "video/mp2t")
+	c.File(filepath.Join(sess.dir, strconv.Itoa(num)+".ts"))
+}
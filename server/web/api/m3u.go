@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	goffprobe "gopkg.in/vansante/go-ffprobe.v2"
 )
 
 // allPlayList godoc
@@ -47,7 +49,7 @@ func allPlayList(c *gin.Context) {
 			list += " tvg-logo=\"" + tr.Poster + "\""
 		}
 		list += " type=\"playlist\"," + tr.Title + "\n"
-		list += host + "/stream/" + url.PathEscape(tr.Title) + ".m3u?link=" + apiutils.JoinHashUser(tr.Hash().HexString(), user) + "&m3u&fn=file.m3u\n"
+		list += host + "/stream/" + url.PathEscape(tr.Title) + ".m3u?link=" + apiutils.JoinHashUser(tr.Hash().HexString(), user) + apiutils.TokenQuery(tr.Hash().HexString(), user) + "&m3u&fn=file.m3u\n"
 		hash += tr.Hash().HexString()
 	}
 
@@ -134,6 +136,7 @@ func getM3uList(tor *state.TorrentStatus, host string, user string, fromLast boo
 			from = pos
 		}
 	}
+	link := apiutils.JoinHashUser(tor.Hash, user) + apiutils.TokenQuery(tor.Hash, user)
 	for i, f := range tor.FileStats {
 		if i >= from {
 			if utils.GetMimeType(f.Path) != "*/*" {
@@ -141,24 +144,46 @@ func getM3uList(tor *state.TorrentStatus, host string, user string, fromLast boo
 				if fn == "" {
 					fn = f.Path
 				}
-				m3u += "#EXTINF:0," + fn + "\n"
-				fileNamesakes := findFileNamesakes(tor.FileStats, f) // find external media with same name (audio/subtiles tracks)
-				if fileNamesakes != nil {
-					m3u += "#EXTVLCOPT:input-slave="         // include VLC option for external media
-					for _, namesake := range fileNamesakes { // include play-links to external media, with # splitter
-						sname := filepath.Base(namesake.Path)
-						m3u += host + "/stream/" + url.PathEscape(sname) + "?link=" + apiutils.JoinHashUser(tor.Hash, user) + "&index=" + fmt.Sprint(namesake.Id) + "&play#"
-					}
-					m3u += "\n"
+				duration := 0
+				if f.Media != nil {
+					duration = int(f.Media.DurationSeconds)
+				}
+				m3u += "#EXTINF:" + strconv.Itoa(duration) + "," + fn + "\n"
+				slaves := getM3uSlaves(tor, f, host, user, link)
+				if slaves != nil {
+					m3u += "#EXTVLCOPT:input-slave=" + strings.Join(slaves, "#") + "\n" // include VLC option for external media, with # splitter
 				}
 				name := filepath.Base(f.Path)
-				m3u += host + "/stream/" + url.PathEscape(name) + "?link=" + apiutils.JoinHashUser(tor.Hash, user) + "&index=" + fmt.Sprint(f.Id) + "&play\n"
+				m3u += host + "/stream/" + url.PathEscape(name) + "?link=" + link + "&index=" + fmt.Sprint(f.Id) + "&play\n"
 			}
 		}
 	}
 	return m3u
 }
 
+// getM3uSlaves returns links to external media with same name (audio/subtiles tracks) and WebVTT links
+// to embedded text subtitles known from stored media info, ass/ssa files are converted to WebVTT too
+func getM3uSlaves(tor *state.TorrentStatus, file *state.TorrentFileStat, host, user, link string) []string {
+	var slaves []string
+	for _, namesake := range findFileNamesakes(tor.FileStats, file) {
+		ext := strings.ToLower(filepath.Ext(namesake.Path))
+		if utils.IsSubtitle(namesake.Path) && ext != ".srt" && ext != ".vtt" {
+			slaves = append(slaves, subtitleLink(host, tor.Hash, user, file.Id, "f"+strconv.Itoa(namesake.Id)))
+			continue
+		}
+		sname := filepath.Base(namesake.Path)
+		slaves = append(slaves, host+"/stream/"+url.PathEscape(sname)+"?link="+link+"&index="+fmt.Sprint(namesake.Id)+"&play")
+	}
+	if file.Media != nil {
+		for _, s := range file.Media.Streams {
+			if s.Type == string(goffprobe.StreamSubtitle) && textSubCodecs[s.Codec] {
+				slaves = append(slaves, subtitleLink(host, tor.Hash, user, file.Id, "s"+strconv.Itoa(s.Index)))
+			}
+		}
+	}
+	return slaves
+}
+
 func findFileNamesakes(files []*state.TorrentFileStat, file *state.TorrentFileStat) []*state.TorrentFileStat {
 	// find files with the same name in torrent
 	name := filepath.Base(strings.TrimSuffix(file.Path, filepath.Ext(file.Path)))
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gin-gonic/gin"
+
+	"server/rutor"
+	"server/torr"
+)
+
+type metricFamily struct {
+	name    string
+	typ     string
+	help    string
+	samples []string
+}
+
+// metricsSet collects samples in prometheus text exposition format, samples of one metric are grouped
+type metricsSet struct {
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// add appends sample of metric, labels are name and value pairs
+func (m *metricsSet) add(name, typ, help string, value float64, labels ...string) {
+	if m.byName == nil {
+		m.byName = make(map[string]*metricFamily)
+	}
+	fam, ok := m.byName[name]
+	if !ok {
+		fam = &metricFamily{name: name, typ: typ, help: help}
+		m.byName[name] = fam
+		m.families = append(m.families, fam)
+	}
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) > 1 {
+		sb.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64))
+	fam.samples = append(fam.samples, sb.String())
+}
+
+func (m *metricsSet) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	for _, fam := range m.families {
+		sb.WriteString("# HELP " + fam.name + " " + fam.help + "\n")
+		sb.WriteString("# TYPE " + fam.name + " " + fam.typ + "\n")
+		for _, s := range fam.samples {
+			sb.WriteString(s + "\n")
+		}
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func boolMetric(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// metrics godoc
+//
+//	@Summary		Prometheus metrics
+//	@Description	Metrics of torrent servers, torrents, caches, streams and rutor db in prometheus text format.
+//
+//	@Tags			API
+//
+//	@Produce		plain
+//	@Success		200	{string}	string	"Metrics"
+//	@Router			/metrics [get]
+func metrics(c *gin.Context) {
+	var m metricsSet
+	servers := 0
+	torr.ForEachServer(func(user string, bt *torr.BTServer) {
+		servers++
+		st := bt.Status()
+		m.add("torrserver_server_connected", "gauge", "Torrent server of user is connected.", boolMetric(st.Connected), "user", user)
+		m.add("torrserver_server_last_used_seconds", "gauge", "Unix time of last use of torrent server.", float64(st.LastUsed), "user", user)
+		m.add("torrserver_server_evictions_total", "counter", "Disconnects of idle torrent server.", float64(st.Evictions), "user", user)
+		m.add("torrserver_server_torrents", "gauge", "Count of active torrents of user.", float64(len(st.Torrents)), "user", user)
+		m.add("torrserver_streams_active", "gauge", "Count of http streams served now.", float64(bt.ActiveStreams()), "user", user)
+		m.add("torrserver_transcodes_active", "gauge", "Count of running ffmpeg transcodes.", float64(st.Transcodes), "user", user)
+		m.add("torrserver_streams_total", "counter", "Count of http streams served since server start.", float64(bt.StreamsTotal()), "user", user)
+
+		torrents := bt.ListTorrents()
+		for _, ts := range st.Torrents {
+			hash := ts.Hash
+			m.add("torrserver_torrent_download_speed_bytes", "gauge", "Download speed of torrent in bytes per second.", ts.DownloadSpeed, "user", user, "hash", hash)
+			m.add("torrserver_torrent_upload_speed_bytes", "gauge", "Upload speed of torrent in bytes per second.", ts.UploadSpeed, "user", user, "hash", hash)
+			m.add("torrserver_torrent_peers_total", "gauge", "Known peers of torrent.", float64(ts.TotalPeers), "user", user, "hash", hash)
+			m.add("torrserver_torrent_peers_active", "gauge", "Active peers of torrent.", float64(ts.ActivePeers), "user", user, "hash", hash)
+			m.add("torrserver_torrent_seeders_connected", "gauge", "Connected seeders of torrent.", float64(ts.ConnectedSeeders), "user", user, "hash", hash)
+			m.add("torrserver_torrent_read_bytes_total", "counter", "Bytes read from peers.", float64(ts.BytesRead), "user", user, "hash", hash)
+			m.add("torrserver_torrent_written_bytes_total", "counter", "Bytes written to peers.", float64(ts.BytesWritten), "user", user, "hash", hash)
+			m.add("torrserver_torrent_pieces_dirtied_bad_total", "counter", "Pieces failed hash check.", float64(ts.PiecesDirtiedBad), "user", user, "hash", hash)
+
+			if t := torrents[metainfo.NewHashFromHex(hash)]; t != nil && t.GetCache() != nil {
+				cache := t.GetCache()
+				m.add("torrserver_cache_capacity_bytes", "gauge", "Capacity of torrent cache.", float64(cache.GetCapacity()), "user", user, "hash", hash)
+				m.add("torrserver_cache_filled_bytes", "gauge", "Filled bytes of torrent cache.", float64(cache.Filled()), "user", user, "hash", hash)
+				m.add("torrserver_cache_readers", "gauge", "Readers of torrent cache in use.", float64(cache.GetUseReaders()), "user", user, "hash", hash)
+			}
+		}
+	})
+	m.add("torrserver_servers", "gauge", "Count of running torrent servers.", float64(servers))
+
+	torrents, words := rutor.Count()
+	m.add("torrserver_rutor_torrents", "gauge", "Torrents in rutor db.", float64(torrents))
+	m.add("torrserver_rutor_indexed_words", "gauge", "Indexed words of rutor search.", float64(words))
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(200)
+	m.WriteTo(c.Writer)
+}
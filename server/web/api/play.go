@@ -22,6 +22,8 @@ import (
 //
 //	@Param			hash		path	string	true	"Torrent hash"
 //	@Param			id			path	string	true	"File index in torrent"
+//	@Param			profile		query	string	false	"Transcode profile: 480p, 720p, 1080p"
+//	@Param			t			query	number	false	"Transcode start position in seconds"
 //
 //	@Produce		application/octet-stream
 //	@Success		200	"Torrent data"
@@ -68,7 +70,7 @@ func play(c *gin.Context) {
 	if tor.Stat == state.TorrentInDB {
 		tor, err = torr.AddTorrent(user, spec, tor.Title, tor.Poster, tor.Data, tor.Category)
 		if err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
+			c.AbortWithError(errStatus(err), err)
 			return
 		}
 	}
@@ -93,5 +95,9 @@ func play(c *gin.Context) {
 		return
 	}
 
+	if profile := c.Query("profile"); profile != "" {
+		transcode(c, tor, user, index, profile)
+		return
+	}
 	tor.Stream(index, c.Request, c.Writer, user)
 }
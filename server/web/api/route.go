@@ -1,7 +1,10 @@
 package api
 
 import (
+	"net/http"
+
 	config "server/settings"
+	"server/torr"
 	"server/web/auth"
 
 	"github.com/gin-gonic/gin"
@@ -31,6 +34,13 @@ func SetupRoute(route gin.IRouter) {
 	route.HEAD("/play/:hash/:id", play)
 	route.GET("/play/:hash/:id", play)
 
+	route.GET("/hls/:hash/:id/:name", hls)
+
+	route.GET("/subtitles/:hash/:id", subtitles)
+	route.GET("/subtitles/:hash/:id/:track", subtitle)
+
+	authorized.GET("/ffp/:hash/:id", ffp)
+
 	authorized.POST("/viewed", viewed)
 
 	authorized.GET("/playlistall/all.m3u", allPlayList)
@@ -40,9 +50,24 @@ func SetupRoute(route gin.IRouter) {
 
 	authorized.GET("/download/:size", download)
 
+	admin := route.Group("/admin", auth.CheckAuth(), auth.CheckAdmin())
+
+	admin.POST("/users", adminUsers)
+	admin.GET("/status", adminStatus)
+
+	authorized.GET("/metrics", auth.CheckAdmin(), metrics)
+
 	if config.SearchWA {
 		route.GET("/search/*query", rutorSearch)
 	} else {
 		authorized.GET("/search/*query", rutorSearch)
 	}
 }
+
+// errStatus returns http status for errors from torr api
+func errStatus(err error) int {
+	if status := torr.QuotaStatus(err); status != 0 {
+		return status
+	}
+	return http.StatusInternalServerError
+}
@@ -1,11 +1,16 @@
 package api
 
 import (
-"net/http"
-"github.com/gin-gonic/gin"
-"github.com/pkg/errors"
+	"net/http"
 
-sets "server/settings"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"server/log"
+	sets "server/settings"
+	"server/torr"
+	"server/web/api/utils"
+	"server/web/auth"
 )
 
 // Action: get, set, def
@@ -14,10 +19,16 @@ type setsReqJS struct {
 	Sets *sets.BTSets `json:"sets,omitempty"`
 }
 
+// setsChangeJS is result of set and def: how settings were applied and changed fields
+type setsChangeJS struct {
+	Apply   string                     `json:"apply"` // live or restart
+	Changes map[string]sets.SetsChange `json:"changes"`
+}
+
 // settings godoc
 //
 //	@Summary		Get / Set server settings
-//	@Description	Allow to get or set server settings.
+//	@Description	Allow to get or set server settings. Actions set and def are available only for admin, they return how settings were applied and changed fields.
 //
 //	@Tags			API
 //
@@ -25,7 +36,7 @@ type setsReqJS struct {
 //
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	sets.BTSets	"Settings JSON or nothing. Depends on what action has been asked."
+//	@Success		200	{object}	sets.BTSets	"Settings JSON for get, setsChangeJS for set and def."
 //	@Router			/settings [post]
 func settings(c *gin.Context) {
 	var req setsReqJS
@@ -36,8 +47,34 @@ func settings(c *gin.Context) {
 	}
 
 	if req.Action == "get" {
-		c.JSON(200, sets.BTsets)
+		c.JSON(200, sets.GetBTSets(utils.UserID(c)))
+		return
+	}
+	// set and def are hidden from users, settings are common for all users
+	isAdmin := !sets.HttpAuth || auth.IsAdmin(c.GetString(gin.AuthUserKey))
+	if isAdmin && (req.Action == "set" || req.Action == "def") {
+		changeSettings(req, c)
 		return
 	}
 	c.AbortWithError(http.StatusBadRequest, errors.New("action is empty"))
 }
+
+func changeSettings(req setsReqJS, c *gin.Context) {
+	if sets.ReadOnly {
+		c.AbortWithError(http.StatusForbidden, errors.New("read-only DB mode"))
+		return
+	}
+	if req.Action == "set" && req.Sets == nil {
+		c.AbortWithError(http.StatusBadRequest, errors.New("sets is empty"))
+		return
+	}
+	old := *sets.BTsets
+	var apply string
+	if req.Action == "set" {
+		apply = torr.SetSettings(req.Sets)
+	} else {
+		apply = torr.SetDefSettings()
+	}
+	log.TLogln("Settings changed by", utils.UserID(c), apply)
+	c.JSON(200, setsChangeJS{Apply: apply, Changes: sets.DiffBTSets(&old, sets.BTsets)})
+}
@@ -25,6 +25,7 @@ import (
 // http://127.0.0.1:8090/stream/fname?link=...&index=1&play&preload
 // http://127.0.0.1:8090/stream/fname?link=...&index=1&play&save
 // http://127.0.0.1:8090/stream/fname?link=...&index=1&play&save&title=...&poster=...
+// http://127.0.0.1:8090/stream/fname?link=...&index=1&play&profile=720p&t=60
 // only save
 // http://127.0.0.1:8090/stream/fname?link=...&save&title=...&poster=...
 
@@ -46,6 +47,8 @@ import (
 //	@Param			title		query	string	false	"Set title of torrent"
 //	@Param			poster		query	string	false	"Set poster link of torrent"
 //	@Param			category	query	string	false	"Set category of torrent, used in web: movie, tv, music, other"
+//	@Param			profile		query	string	false	"Transcode profile: 480p, 720p, 1080p"
+//	@Param			t			query	number	false	"Transcode start position in seconds"
 //
 //	@Produce		application/octet-stream
 //	@Success		200	"Data returned according to query"
@@ -62,6 +65,7 @@ func stream(c *gin.Context) {
 	title := c.Query("title")
 	poster := c.Query("poster")
 	category := c.Query("category")
+	profile := c.Query("profile")
 
 	data := ""
 	user := utils.UserID(c)
@@ -102,7 +106,7 @@ func stream(c *gin.Context) {
 	if tor == nil || tor.Stat == state.TorrentInDB {
 		tor, err = torr.AddTorrent(user, spec, title, poster, data, category)
 		if err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
+			c.AbortWithError(errStatus(err), err)
 			return
 		}
 	}
@@ -143,6 +147,7 @@ func stream(c *gin.Context) {
 	// return stat if query
 	if stat {
 		status := tor.Status()
+		status.Token = utils.StreamToken(status.Hash, user)
 		status.Hash = utils.JoinHashUser(status.Hash, user)
 		c.JSON(200, status)
 		return
@@ -161,6 +166,10 @@ func stream(c *gin.Context) {
 	} else
 	// return play if query
 	if play {
+		if profile != "" {
+			transcode(c, tor, user, index, profile)
+			return
+		}
 		tor.Stream(index, c.Request, c.Writer, user)
 		return
 	}
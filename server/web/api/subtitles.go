@@ -0,0 +1,222 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	goffprobe "gopkg.in/vansante/go-ffprobe.v2"
+
+	"server/ffmpeg"
+	"server/ffprobe"
+	"server/log"
+	"server/torr"
+	"server/torr/state"
+	utils2 "server/utils"
+	"server/web/api/utils"
+)
+
+// text subtitle codecs convertible to WebVTT, bitmap subtitles are only listed
+var textSubCodecs = map[string]bool{
+	"subrip":   true,
+	"ass":      true,
+	"ssa":      true,
+	"webvtt":   true,
+	"mov_text": true,
+	"text":     true,
+}
+
+type subtitleJS struct {
+	ID       string `json:"id"` // f<file id> for external file, s<stream index> for embedded track
+	Name     string `json:"name"`
+	Lang     string `json:"lang,omitempty"`
+	Codec    string `json:"codec,omitempty"`
+	External bool   `json:"external"`
+	Default  bool   `json:"default,omitempty"`
+	URL      string `json:"url,omitempty"` // WebVTT link, empty for bitmap subtitles
+}
+
+// subtitles godoc
+//
+//	@Summary		List subtitles of torrent file
+//	@Description	List external subtitle files matched to video by name and embedded subtitle tracks found by ffprobe.
+//
+//	@Tags			API
+//
+//	@Param			hash	path	string	true	"Torrent hash"
+//	@Param			id		path	string	true	"File index in torrent"
+//
+//	@Produce		json
+//	@Success		200	{array}	subtitleJS	"Subtitles"
+//	@Router			/subtitles/{hash}/{id} [get]
+func subtitles(c *gin.Context) {
+	tor, user, index, ok := torrentFile(c, c.Param("hash"), c.Param("id"))
+	if !ok {
+		return
+	}
+	st := tor.Status()
+	video := findFileStat(st, index)
+	if video == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	host := utils2.GetScheme(c) + "://" + c.Request.Host
+	list := make([]*subtitleJS, 0)
+	for _, f := range findSubtitles(st.FileStats, video) {
+		id := "f" + strconv.Itoa(f.Id)
+		list = append(list, &subtitleJS{
+			ID:       id,
+			Name:     filepath.Base(f.Path),
+			Lang:     utils2.SubtitleLang(video.Path, f.Path),
+			Codec:    strings.TrimPrefix(strings.ToLower(filepath.Ext(f.Path)), "."),
+			External: true,
+			URL:      subtitleLink(host, st.Hash, user, index, id),
+		})
+	}
+
+	if ffprobe.Exists() {
+		info, err := tor.Probe(index)
+		if err != nil {
+			log.TLogln("Error probe subtitles", st.Hash, index, err)
+		} else {
+			for _, s := range info.Streams {
+				if s.Type != string(goffprobe.StreamSubtitle) {
+					continue
+				}
+				id := "s" + strconv.Itoa(s.Index)
+				sub := &subtitleJS{
+					ID:      id,
+					Name:    s.Title,
+					Lang:    s.Language,
+					Codec:   s.Codec,
+					Default: s.Default,
+				}
+				if textSubCodecs[s.Codec] {
+					sub.URL = subtitleLink(host, st.Hash, user, index, id)
+				}
+				list = append(list, sub)
+			}
+		}
+	}
+
+	c.JSON(200, list)
+}
+
+// subtitle godoc
+//
+//	@Summary		Get subtitle track as WebVTT
+//	@Description	Convert external subtitle file or embedded text subtitle track to WebVTT.
+//
+//	@Tags			API
+//
+//	@Param			hash	path	string	true	"Torrent hash"
+//	@Param			id		path	string	true	"File index in torrent"
+//	@Param			track	path	string	true	"Track id from subtitles list with .vtt extension"
+//
+//	@Produce		text/vtt
+//	@Success		200	"WebVTT subtitles"
+//	@Router			/subtitles/{hash}/{id}/{track} [get]
+func subtitle(c *gin.Context) {
+	tor, user, index, ok := torrentFile(c, c.Param("hash"), c.Param("id"))
+	if !ok {
+		return
+	}
+	track := strings.TrimSuffix(c.Param("track"), ".vtt")
+	if len(track) < 2 {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	num, err := strconv.Atoi(track[1:])
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	hash := tor.Hash().HexString()
+
+	var buf bytes.Buffer
+	switch track[0] {
+	case 'f':
+		f := findFileStat(tor.Status(), num)
+		if f == nil || !utils2.IsSubtitle(f.Path) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		err = externalSubtitle(c.Request.Context(), torr.LocalPlayLink(user, hash, num), f.Path, &buf)
+	case 's':
+		if !ffmpeg.Exists() {
+			c.AbortWithError(http.StatusNotImplemented, errors.New("ffmpeg not found"))
+			return
+		}
+		err = ffmpeg.Subtitle(c.Request.Context(), torr.LocalPlayLink(user, hash, index), num, &buf)
+	default:
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(200, "text/vtt; charset=utf-8", buf.Bytes())
+}
+
+// externalSubtitle converts subtitle file to WebVTT, srt and vtt are converted without ffmpeg
+func externalSubtitle(ctx context.Context, link, path string, w io.Writer) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".srt" && ext != ".vtt" {
+		if !ffmpeg.Exists() {
+			return errors.New("ffmpeg not found")
+		}
+		return ffmpeg.Subtitle(ctx, link, -1, w)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error get subtitle file: %s", resp.Status)
+	}
+	if ext == ".vtt" {
+		_, err = io.Copy(w, resp.Body)
+		return err
+	}
+	return utils2.SrtToVtt(resp.Body, w)
+}
+
+func findFileStat(st *state.TorrentStatus, id int) *state.TorrentFileStat {
+	for _, f := range st.FileStats {
+		if f.Id == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// findSubtitles returns subtitle files with name of video
+func findSubtitles(files []*state.TorrentFileStat, video *state.TorrentFileStat) []*state.TorrentFileStat {
+	var subs []*state.TorrentFileStat
+	for _, f := range findFileNamesakes(files, video) {
+		if utils2.IsSubtitle(f.Path) {
+			subs = append(subs, f)
+		}
+	}
+	return subs
+}
+
+func subtitleLink(host, hash, user string, index int, track string) string {
+	return host + "/subtitles/" + utils.JoinHashUser(hash, user) + "/" + strconv.Itoa(index) + "/" + track + ".vtt" +
+		strings.Replace(utils.TokenQuery(hash, user), "&", "?", 1)
+}
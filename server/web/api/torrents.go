@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"server/log"
@@ -13,7 +14,7 @@ import (
 	"github.com/pkg/errors"
 )
 
-// Action: add, get, set, rem, list, drop
+// Action: add, get, set, rem, list, drop, download, stop
 type torrReqJS struct {
 	requestI
 	Link     string `json:"link,omitempty"`
@@ -23,16 +24,26 @@ type torrReqJS struct {
 	Poster   string `json:"poster,omitempty"`
 	Data     string `json:"data,omitempty"`
 	SaveToDB bool   `json:"save_to_db,omitempty"`
+	Files    []int  `json:"files,omitempty"` // ids of files for download and stop, all files if empty
+
+	// list: category filter is in Category, total count of matched torrents is in X-Total-Count header
+	Search  string             `json:"search,omitempty"` // substring of title
+	Stat    *state.TorrentStat `json:"stat,omitempty"`
+	Viewed  *bool              `json:"viewed,omitempty"` // torrents with or without viewed files
+	Sort    string             `json:"sort,omitempty"`   // added, title, size, viewed
+	Reverse bool               `json:"reverse,omitempty"`
+	Offset  int                `json:"offset,omitempty"`
+	Limit   int                `json:"limit,omitempty"`
 }
 
 // torrents godoc
 //
 //	@Summary		Handle torrents informations
-//	@Description	Allow to list, add, remove, get, set, drop, wipe torrents on server. The action depends of what has been asked.
+//	@Description	Allow to list, add, remove, get, set, drop, wipe torrents on server, download files of torrent to DownloadPath or stop download. The action depends of what has been asked.
 //
 //	@Tags			API
 //
-//	@Param			request	body	torrReqJS	true	"Torrent request. Available params for action: add, get, set, rem, list, drop, wipe. link required for add, hash required for get, set, rem, drop."
+//	@Param			request	body	torrReqJS	true	"Torrent request. Available params for action: add, get, set, rem, list, drop, wipe, download, stop. link required for add, hash required for get, set, rem, drop, download, stop. list filters by category, search, stat, viewed, sorts by sort (added, title, size, viewed) and returns limit torrents from offset, total count is in X-Total-Count header."
 //
 //	@Accept			json
 //	@Produce		json
@@ -66,7 +77,7 @@ func torrents(c *gin.Context) {
 		}
 	case "list":
 		{
-			listTorrents(user, c)
+			listTorrents(user, req, c)
 		}
 	case "drop":
 		{
@@ -76,6 +87,14 @@ func torrents(c *gin.Context) {
 		{
 			wipeTorrents(user, c)
 		}
+	case "download":
+		{
+			downloadTorrent(user, req, c)
+		}
+	case "stop":
+		{
+			stopDownload(user, req, c)
+		}
 	}
 }
 
@@ -103,7 +122,7 @@ func addTorrent(user string, req torrReqJS, c *gin.Context) {
 	// }
 	if err != nil {
 		log.TLogln("error add torrent:", user, err)
-		c.AbortWithError(http.StatusInternalServerError, err)
+		c.AbortWithError(errStatus(err), err)
 		return
 	}
 
@@ -129,6 +148,7 @@ func addTorrent(user string, req torrReqJS, c *gin.Context) {
 	}()
 
 	st := tor.Status()
+	st.Token = utils.StreamToken(st.Hash, user)
 	st.Hash = utils.JoinHashUser(st.Hash, user)
 	c.JSON(200, st)
 }
@@ -148,6 +168,7 @@ func getTorrent(user string, req torrReqJS, c *gin.Context) {
 
 	if tor != nil {
 		st := tor.Status()
+		st.Token = utils.StreamToken(st.Hash, reqUser)
 		st.Hash = utils.JoinHashUser(st.Hash, reqUser)
 		c.JSON(200, st)
 	} else {
@@ -185,15 +206,28 @@ func remTorrent(user string, req torrReqJS, c *gin.Context) {
 	c.Status(200)
 }
 
-func listTorrents(user string, c *gin.Context) {
-	list := torr.ListTorrent(user)
-	if len(list) == 0 {
-		c.JSON(200, []*state.TorrentStatus{})
+func listTorrents(user string, req torrReqJS, c *gin.Context) {
+	switch req.Sort {
+	case "", "added", "title", "size", "viewed":
+	default:
+		c.AbortWithError(http.StatusBadRequest, errors.New("wrong sort"))
 		return
 	}
-	var stats []*state.TorrentStatus
+	list, total := torr.FilterTorrents(user, torr.ListTorrent(user), &torr.ListFilter{
+		Category: req.Category,
+		Search:   req.Search,
+		Stat:     req.Stat,
+		Viewed:   req.Viewed,
+		Sort:     req.Sort,
+		Reverse:  req.Reverse,
+		Offset:   req.Offset,
+		Limit:    req.Limit,
+	})
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	stats := make([]*state.TorrentStatus, 0, len(list))
 	for _, tr := range list {
 		st := tr.Status()
+		st.Token = utils.StreamToken(st.Hash, user)
 		st.Hash = utils.JoinHashUser(st.Hash, user)
 		stats = append(stats, st)
 	}
@@ -222,3 +256,41 @@ func wipeTorrents(user string, c *gin.Context) {
 	}
 	c.Status(200)
 }
+
+func downloadTorrent(user string, req torrReqJS, c *gin.Context) {
+	if req.Hash == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("hash is empty"))
+		return
+	}
+	hash, reqUser, ok := utils.ResolveHashUser(c, req.Hash, user)
+	if !ok {
+		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	tor, err := torr.DownloadTorrent(reqUser, hash, req.Files)
+	if err != nil {
+		log.TLogln("error download torrent:", reqUser, err)
+		c.AbortWithError(errStatus(err), err)
+		return
+	}
+	st := tor.Status()
+	st.Token = utils.StreamToken(st.Hash, reqUser)
+	st.Hash = utils.JoinHashUser(st.Hash, reqUser)
+	c.JSON(200, st)
+}
+
+func stopDownload(user string, req torrReqJS, c *gin.Context) {
+	if req.Hash == "" {
+		c.AbortWithError(http.StatusBadRequest, errors.New("hash is empty"))
+		return
+	}
+	hash, reqUser, ok := utils.ResolveHashUser(c, req.Hash, user)
+	if !ok {
+		c.Header("WWW-Authenticate", "Basic realm=Authorization Required")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	torr.StopDownload(reqUser, hash, req.Files)
+	c.Status(200)
+}
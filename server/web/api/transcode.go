@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"server/ffmpeg"
+	"server/log"
+	"server/torr"
+)
+
+// transcode streams file of torrent encoded by ffmpeg with profile, ffmpeg stops when client disconnects
+func transcode(c *gin.Context, tor *torr.Torrent, user string, index int, name string) {
+	profile, ok := ffmpeg.Profiles[name]
+	if !ok {
+		c.AbortWithError(http.StatusBadRequest, errors.New("unknown profile"))
+		return
+	}
+	if !ffmpeg.Exists() {
+		c.AbortWithError(http.StatusNotImplemented, errors.New("ffmpeg not found"))
+		return
+	}
+	start, _ := strconv.ParseFloat(c.Query("t"), 64)
+
+	release, err := torr.AcquireTranscode(user)
+	if err != nil {
+		c.AbortWithError(errStatus(err), err)
+		return
+	}
+	defer release()
+
+	c.Header("Content-Type", "video/mp2t")
+	c.Header("Connection", "close")
+	c.Status(http.StatusOK)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+
+	link := torr.LocalPlayLink(user, tor.Hash().HexString(), index)
+	log.TLogln("Start transcode", name, tor.Hash().HexString(), index, user)
+	if err = ffmpeg.Transcode(c.Request.Context(), link, start, profile, c.Writer); err != nil {
+		log.TLogln("Error transcode", name, tor.Hash().HexString(), index, err)
+		return
+	}
+	log.TLogln("End transcode", name, tor.Hash().HexString(), index, user)
+}
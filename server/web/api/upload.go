@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 
 	"server/log"
@@ -57,6 +58,7 @@ func torrentUpload(c *gin.Context) {
 	}
 	user := utils.UserID(c)
 	var tor *torr.Torrent
+	var addErr error
 	for name, file := range form.File {
 		log.TLogln("add .torrent", user, name)
 
@@ -74,6 +76,11 @@ func torrentUpload(c *gin.Context) {
 		}
 
 		tor, err = torr.AddTorrent(user, spec, title, poster, data, category)
+		if err != nil {
+			log.TLogln("error upload torrent:", user, err)
+			addErr = err
+			continue
+		}
 
 		if tor.Data != "" && set.BTsets.EnableDebug {
 			log.TLogln("torrent data:", user, tor.Data)
@@ -82,11 +89,6 @@ func torrentUpload(c *gin.Context) {
 			log.TLogln("torrent category:", user, tor.Category)
 		}
 
-		if err != nil {
-			log.TLogln("error upload torrent:", user, err)
-			continue
-		}
-
 		go func() {
 			if !tor.GotInfo() {
 				log.TLogln("error add torrent:", user, "timeout connection torrent")
@@ -105,7 +107,16 @@ func torrentUpload(c *gin.Context) {
 		break
 	}
 
+	if tor == nil {
+		if addErr == nil {
+			addErr = errors.New("no torrent file added")
+		}
+		c.AbortWithError(errStatus(addErr), addErr)
+		return
+	}
+
 	status := tor.Status()
+	status.Token = utils.StreamToken(status.Hash, user)
 	status.Hash = utils.JoinHashUser(status.Hash, user)
 	c.JSON(200, status)
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"server/settings"
 	"server/web/auth"
 )
 
@@ -34,14 +35,32 @@ func JoinHashUser(hash, user string) string {
 	return fmt.Sprintf("%s:%s", hash, user)
 }
 
+// TokenQuery returns "&token=..." query part with signed stream token of hash and user.
+// Empty string is returned when authentication is disabled.
+func TokenQuery(hash, user string) string {
+	if token := StreamToken(hash, user); token != "" {
+		return "&token=" + token
+	}
+	return ""
+}
+
+// StreamToken returns signed stream token of hash and user for links built by clients.
+// Empty string is returned when authentication is disabled.
+func StreamToken(hash, user string) string {
+	if !settings.HttpAuth {
+		return ""
+	}
+	return auth.StreamToken(user, hash)
+}
+
 // ResolveHashUser splits the hash and validates that the requested user is authorized.
 // When authentication is required, the user is resolved in the following order:
 //  1. Authenticated user from the request context (Authorization header).
-//  2. User specified in the hash (format: "hash:user").
+//  2. User specified in the hash (format: "hash:user") with valid "token" query param.
 //  3. defaultUser (only when authentication is not required).
 //
-// Authorization errors are returned only when the user is missing both in the
-// Authorization header and the hash.
+// Authorization errors are returned when the user is missing in the Authorization
+// header and the hash or when the token of user from the hash is wrong or expired.
 func ResolveHashUser(c *gin.Context, hashWithUser, defaultUser string) (hash string, user string, ok bool) {
 	hash, userFromHash := SplitHashUser(hashWithUser, "")
 	authRequired := c.GetBool("auth_required")
@@ -51,6 +70,9 @@ func ResolveHashUser(c *gin.Context, hashWithUser, defaultUser string) (hash str
 	case authUser != "":
 		user = authUser
 	case userFromHash != "":
+		if authRequired && !auth.VerifyStreamToken(c.Query("token"), userFromHash, hash) {
+			return "", "", false
+		}
 		user = userFromHash
 	case !authRequired:
 		user = defaultUser
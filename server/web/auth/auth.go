@@ -1,11 +1,13 @@
 package auth
 
 import (
-	"encoding/base64"
+	"crypto/sha256"
 	"encoding/json"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"unsafe"
 
 	"github.com/gin-gonic/gin"
@@ -14,79 +16,180 @@ import (
 	"server/settings"
 )
 
-var accounts gin.Accounts
+var (
+	accounts   map[string]*settings.Account
+	muAccounts sync.RWMutex
+
+	// verified holds sha256 of checked Authorization headers, to not verify password hash on every request
+	verified = make(map[[sha256.Size]byte]string)
+)
 
 func SetupAuth(engine *gin.Engine) {
 	if !settings.HttpAuth {
 		return
 	}
+	Reload()
+	engine.Use(BasicAuth())
+	go watchAccounts()
+}
+
+// Accounts returns copy of accounts from accs.db merged with accounts from settings db
+func Accounts() map[string]settings.Account {
 	accs := getAccounts()
-	if accs == nil {
-		return
+	ret := make(map[string]settings.Account, len(accs))
+	for user, acc := range accs {
+		ret[user] = *acc
 	}
-	accounts = accs
-	engine.Use(BasicAuth(accs))
+	return ret
 }
 
-func Accounts() gin.Accounts {
-	return accounts
+// Users returns sorted names of enabled accounts
+func Users() []string {
+	var users []string
+	for user, acc := range getAccounts() {
+		if !acc.Disabled {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	return users
 }
 
 func UserExists(user string) bool {
 	if user == "" {
 		return false
 	}
+	acc, ok := getAccounts()[user]
+	return ok && !acc.Disabled
+}
+
+func IsAdmin(user string) bool {
+	if user == "" {
+		return false
+	}
+	acc, ok := getAccounts()[user]
+	return ok && !acc.Disabled && acc.IsAdmin()
+}
 
+// KeepsAdmin reports whether enabled admin is left after account of user is replaced by acc.
+// Nil acc removes account of user from settings db, account from accs.db is active again.
+// Change is allowed if there were no enabled admins before it.
+func KeepsAdmin(user string, acc *settings.Account) bool {
 	accs := Accounts()
-	if accs == nil {
-		accs = getAccounts()
+	if !hasAdmin(accs) {
+		return true
+	}
+	if acc != nil {
+		accs[user] = *acc
+	} else if file, ok := readAccsDB()[user]; ok {
+		accs[user] = *file
+	} else {
+		delete(accs, user)
 	}
+	return hasAdmin(accs)
+}
 
-	if accs == nil {
-		return false
+func hasAdmin(accs map[string]settings.Account) bool {
+	for _, acc := range accs {
+		if !acc.Disabled && acc.IsAdmin() {
+			return true
+		}
 	}
+	return false
+}
 
-	_, ok := accs[user]
+// FileAccount reports whether user is defined in accs.db
+func FileAccount(user string) bool {
+	_, ok := readAccsDB()[user]
 	return ok
 }
 
-func getAccounts() gin.Accounts {
+func getAccounts() map[string]*settings.Account {
+	muAccounts.RLock()
+	accs := accounts
+	muAccounts.RUnlock()
+	if accs == nil {
+		accs = loadAccounts()
+	}
+	return accs
+}
+
+// loadAccounts merges accs.db with accounts from settings db, settings db wins
+func loadAccounts() map[string]*settings.Account {
+	accs := readAccsDB()
+	for user, acc := range settings.ListAccounts() {
+		accs[user] = acc
+	}
+	return accs
+}
+
+// readAccsDB parses accs.db, value is password or account object:
+// {"user1": "pass1", "user2": {"password": "$2a$10$...", "role": "admin"}}
+func readAccsDB() map[string]*settings.Account {
+	accs := make(map[string]*settings.Account)
 	buf, err := os.ReadFile(filepath.Join(settings.Path, "accs.db"))
 	if err != nil {
-		return nil
+		return accs
 	}
-	var accs gin.Accounts
-	err = json.Unmarshal(buf, &accs)
-	if err != nil {
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(buf, &raw); err != nil {
 		log.TLogln("Error parse accs.db", err)
+		return accs
+	}
+	for user, val := range raw {
+		acc := new(settings.Account)
+		if err = json.Unmarshal(val, &acc.Password); err != nil {
+			if err = json.Unmarshal(val, acc); err != nil {
+				log.TLogln("Error parse account in accs.db", user, err)
+				continue
+			}
+		}
+		if acc.Role == "" {
+			acc.Role = settings.RoleUser
+		}
+		accs[user] = acc
 	}
 	return accs
 }
 
-type authPair struct {
-	value string
-	user  string
-}
-type authPairs []authPair
-
-func (a authPairs) searchCredential(authValue string) (string, bool) {
+// searchCredential returns user of Authorization header value if password is valid
+func searchCredential(authValue string) (string, bool) {
 	if authValue == "" {
 		return "", false
 	}
-	for _, pair := range a {
-		if pair.value == authValue {
-			return pair.user, true
-		}
+	req := http.Request{Header: http.Header{"Authorization": {authValue}}}
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	key := sha256.Sum256(StringToBytes(authValue))
+
+	muAccounts.RLock()
+	acc, exists := accounts[user]
+	cached, isCached := verified[key]
+	muAccounts.RUnlock()
+
+	if !exists || acc.Disabled {
+		return "", false
 	}
-	return "", false
+	if isCached && cached == user {
+		return user, true
+	}
+	if !checkPassword(acc.Password, password) {
+		return "", false
+	}
+
+	muAccounts.Lock()
+	verified[key] = user
+	muAccounts.Unlock()
+	return user, true
 }
 
-func BasicAuth(accounts gin.Accounts) gin.HandlerFunc {
-	pairs := processAccounts(accounts)
+func BasicAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("auth_required", true)
 
-		user, found := pairs.searchCredential(c.Request.Header.Get("Authorization"))
+		user, found := searchCredential(c.Request.Header.Get("Authorization"))
 		if found {
 			c.Set(gin.AuthUserKey, user)
 		}
@@ -119,21 +222,19 @@ func CheckAuth() gin.HandlerFunc {
 	}
 }
 
-func processAccounts(accounts gin.Accounts) authPairs {
-	pairs := make(authPairs, 0, len(accounts))
-	for user, password := range accounts {
-		value := authorizationHeader(user, password)
-		pairs = append(pairs, authPair{
-			value: value,
-			user:  user,
-		})
-	}
-	return pairs
-}
+// CheckAdmin allows request only for admin accounts, without http auth everybody is admin
+func CheckAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !settings.HttpAuth {
+			return
+		}
 
-func authorizationHeader(user, password string) string {
-	base := user + ":" + password
-	return "Basic " + base64.StdEncoding.EncodeToString(StringToBytes(base))
+		if IsAdmin(c.GetString(gin.AuthUserKey)) {
+			return
+		}
+
+		c.AbortWithStatus(http.StatusForbidden)
+	}
 }
 
 func StringToBytes(s string) (b []byte) {
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"server/log"
+	"server/settings"
+)
+
+var (
+	changeHooks   []func(added, removed []string)
+	muChangeHooks sync.Mutex
+)
+
+// OnAccountsChange registers fn called with added and removed users after accounts reload
+func OnAccountsChange(fn func(added, removed []string)) {
+	muChangeHooks.Lock()
+	changeHooks = append(changeHooks, fn)
+	muChangeHooks.Unlock()
+}
+
+// Reload rereads accounts, resets verified credentials and notifies about added and removed users,
+// disabled accounts are reported as removed
+func Reload() {
+	accs := loadAccounts()
+
+	muAccounts.Lock()
+	old := accounts
+	accounts = accs
+	verified = make(map[[sha256.Size]byte]string)
+	muAccounts.Unlock()
+
+	enabled := func(accs map[string]*settings.Account, user string) bool {
+		acc, ok := accs[user]
+		return ok && !acc.Disabled
+	}
+	var added, removed []string
+	for user := range accs {
+		if enabled(accs, user) && !enabled(old, user) {
+			added = append(added, user)
+		}
+	}
+	for user := range old {
+		if enabled(old, user) && !enabled(accs, user) {
+			removed = append(removed, user)
+		}
+	}
+	if old == nil || len(added)+len(removed) == 0 {
+		return
+	}
+	log.TLogln("Accounts reloaded, added:", added, "removed:", removed)
+
+	muChangeHooks.Lock()
+	hooks := append([]func(added, removed []string){}, changeHooks...)
+	muChangeHooks.Unlock()
+	for _, fn := range hooks {
+		fn(added, removed)
+	}
+}
+
+// watchAccounts reloads accounts on accs.db change
+func watchAccounts() {
+	name := filepath.Join(settings.Path, "accs.db")
+	modTime := func() time.Time {
+		if fi, err := os.Stat(name); err == nil {
+			return fi.ModTime()
+		}
+		return time.Time{}
+	}
+	last := modTime()
+	for {
+		time.Sleep(5 * time.Second)
+		if mt := modTime(); !mt.Equal(last) {
+			last = mt
+			log.TLogln("Accounts file changed, reload", name)
+			Reload()
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/settings"
+)
+
+// tokenSecret is key of token signatures
+var tokenSecret = settings.TokenSecret
+
+// StreamToken returns signed token allowing user to stream torrent without basic auth,
+// token format is <expiry unix time>.<base64 hmac-sha256 of user, hash and expiry>
+func StreamToken(user, hash string) string {
+	ttl := 168
+	if settings.BTsets != nil && settings.BTsets.StreamTokenTTL > 0 {
+		ttl = settings.BTsets.StreamTokenTTL
+	}
+	return signToken(user, hash, time.Now().Add(time.Duration(ttl)*time.Hour).Unix())
+}
+
+// VerifyStreamToken checks that token is signed for user and hash and not expired
+func VerifyStreamToken(token, user, hash string) bool {
+	exp, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(signToken(user, hash, expiry)))
+}
+
+func signToken(user, hash string, expiry int64) string {
+	exp := strconv.FormatInt(expiry, 10)
+	mac := hmac.New(sha256.New, tokenSecret())
+	mac.Write([]byte(user + "\x00" + strings.ToLower(hash) + "\x00" + exp))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	tokenSecret = func() []byte { return []byte("test secret of stream tokens....") }
+}
+
+func TestVerifyStreamToken(t *testing.T) {
+	const hash = "0123456789abcdef0123456789abcdef01234567"
+	valid := StreamToken("user", hash)
+	exp, mac, _ := strings.Cut(valid, ".")
+	expired := signToken("user", hash, time.Now().Add(-time.Minute).Unix())
+	// expiry moved forward with old mac
+	extended := strconv.FormatInt(time.Now().Add(time.Hour*1000).Unix(), 10) + "." + mac
+	tampered := exp + "." + strings.Repeat("A", len(mac))
+
+	tests := []struct {
+		name        string
+		token, user string
+		hash        string
+		want        bool
+	}{
+		{"valid", valid, "user", hash, true},
+		{"hash case", valid, "user", strings.ToUpper(hash), true},
+		{"expired", expired, "user", hash, false},
+		{"wrong user", valid, "other", hash, false},
+		{"wrong hash", valid, "user", strings.Repeat("f", 40), false},
+		{"tampered mac", tampered, "user", hash, false},
+		{"tampered expiry", extended, "user", hash, false},
+		{"missing dot", exp + mac, "user", hash, false},
+		{"empty", "", "user", hash, false},
+	}
+	for _, tt := range tests {
+		if got := VerifyStreamToken(tt.token, tt.user, tt.hash); got != tt.want {
+			t.Errorf("%s: VerifyStreamToken = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
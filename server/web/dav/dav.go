@@ -0,0 +1,44 @@
+package dav
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/webdav"
+
+	"server/log"
+	"server/settings"
+	apiutils "server/web/api/utils"
+	"server/web/auth"
+)
+
+// locks is required by webdav handler, lock methods are rejected as any other write
+var locks = webdav.NewMemLS()
+
+// SetupRoute registers read-only webdav view of user torrents at /dav/
+func SetupRoute(route gin.IRouter) {
+	authorized := route.Group("/dav", auth.CheckAuth())
+	for _, method := range []string{"OPTIONS", "GET", "HEAD", "PROPFIND"} {
+		authorized.Handle(method, "/*path", serve)
+	}
+	for _, method := range []string{"PUT", "POST", "DELETE", "MKCOL", "COPY", "MOVE", "PROPPATCH", "LOCK", "UNLOCK"} {
+		authorized.Handle(method, "/*path", func(c *gin.Context) {
+			c.Header("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+			c.AbortWithStatus(http.StatusMethodNotAllowed)
+		})
+	}
+}
+
+func serve(c *gin.Context) {
+	h := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: &davFS{user: apiutils.UserID(c)},
+		LockSystem: locks,
+		Logger: func(r *http.Request, err error) {
+			if err != nil && settings.BTsets.EnableDebug {
+				log.TLogln("WebDAV", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	h.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,321 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	mt "server/mimetype"
+	"server/torr"
+	"server/torr/state"
+	"server/torr/storage/torrstor"
+)
+
+// davFS is read-only webdav view of user torrents, torrents are directories named by title
+// and files keep their paths inside torrent. It is created per request and keeps torrent list of request
+type davFS struct {
+	user string
+	list []davTorrent
+	done bool
+}
+
+type davTorrent struct {
+	name string
+	tor  *torr.Torrent
+}
+
+func (d *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (d *davFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (d *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (d *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	f, err := d.open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.Stat()
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	return d.open(name)
+}
+
+func (d *davFS) open(name string) (webdav.File, error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	torrents := d.torrents()
+	if name == "" {
+		infos := make([]os.FileInfo, 0, len(torrents))
+		for _, t := range torrents {
+			infos = append(infos, &fileInfo{name: t.name, modTime: time.Unix(t.tor.Timestamp, 0), dir: true})
+		}
+		return &dir{info: &fileInfo{name: "/", dir: true}, children: infos}, nil
+	}
+
+	tname, fpath, _ := strings.Cut(name, "/")
+	var dt *davTorrent
+	for i := range torrents {
+		if torrents[i].name == tname {
+			dt = &torrents[i]
+			break
+		}
+	}
+	if dt == nil {
+		return nil, os.ErrNotExist
+	}
+	modTime := time.Unix(dt.tor.Timestamp, 0)
+	if fpath == "" {
+		// files are read only on listing, properties of torrent directory don't need them
+		return &dir{info: &fileInfo{name: tname, modTime: modTime, dir: true}, load: func() []os.FileInfo {
+			return dt.children("")
+		}}, nil
+	}
+
+	for _, f := range torr.StoredFiles(dt.tor) {
+		if f.Path == fpath {
+			info := &fileInfo{name: path.Base(f.Path), size: f.Length, modTime: modTime, hash: dt.tor.Hash().HexString(), path: f.Path}
+			return &file{user: d.user, hash: info.hash, id: f.Id, info: info}, nil
+		}
+	}
+	children := dt.children(fpath)
+	if len(children) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return &dir{info: &fileInfo{name: path.Base(fpath), modTime: modTime, dir: true}, children: children}, nil
+}
+
+// children returns sorted entries of directory dpath inside torrent, files of torrent in db
+// are taken from saved file list, so listing doesn't connect torrent
+func (dt *davTorrent) children(dpath string) []os.FileInfo {
+	modTime := time.Unix(dt.tor.Timestamp, 0)
+	children := make(map[string]os.FileInfo)
+	for _, f := range torr.StoredFiles(dt.tor) {
+		rest := f.Path
+		if dpath != "" {
+			if !strings.HasPrefix(f.Path, dpath+"/") {
+				continue
+			}
+			rest = f.Path[len(dpath)+1:]
+		}
+		child, _, isDir := strings.Cut(rest, "/")
+		if _, ok := children[child]; ok {
+			continue
+		}
+		if isDir {
+			children[child] = &fileInfo{name: child, modTime: modTime, dir: true}
+		} else {
+			children[child] = &fileInfo{name: child, size: f.Length, modTime: modTime, hash: dt.tor.Hash().HexString(), path: f.Path}
+		}
+	}
+	infos := make([]os.FileInfo, 0, len(children))
+	for _, info := range children {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos
+}
+
+// torrents returns torrents of user with unique directory names, list is built once per request
+func (d *davFS) torrents() []davTorrent {
+	if d.done {
+		return d.list
+	}
+	d.done = true
+	list := torr.ListTorrent(d.user)
+	ret := make([]davTorrent, 0, len(list))
+	seen := make(map[string]bool)
+	for _, tor := range list {
+		name := tor.Title
+		if name == "" && tor.TorrentSpec != nil {
+			name = tor.TorrentSpec.DisplayName
+		}
+		hash := tor.Hash().HexString()
+		name = strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(name))
+		if name == "" || name == "." || name == ".." {
+			name = hash
+		}
+		if seen[name] {
+			name += " [" + hash[:8] + "]"
+		}
+		seen[name] = true
+		ret = append(ret, davTorrent{name: name, tor: tor})
+	}
+	d.list = ret
+	return ret
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	hash    string
+	path    string
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// ContentType is taken from file extension, otherwise webdav reads start of file and it would be downloaded
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.dir {
+		return "", webdav.ErrNotImplemented
+	}
+	mime, err := mt.MimeTypeByPath(fi.path)
+	if err != nil {
+		return "application/octet-stream", nil
+	}
+	return mime.String(), nil
+}
+
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.dir {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.hash + "/" + strings.ReplaceAll(fi.path, `"`, "") + `"`, nil
+}
+
+type dir struct {
+	info     *fileInfo
+	children []os.FileInfo
+	load     func() []os.FileInfo // loads children on first Readdir
+	pos      int
+}
+
+func (d *dir) Close() error                                 { return nil }
+func (d *dir) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (d *dir) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+func (d *dir) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (d *dir) Stat() (os.FileInfo, error)                   { return d.info, nil }
+
+func (d *dir) Readdir(count int) ([]os.FileInfo, error) {
+	if d.load != nil {
+		d.children, d.load = d.load(), nil
+	}
+	left := d.children[d.pos:]
+	if count <= 0 {
+		d.pos = len(d.children)
+		return left, nil
+	}
+	if len(left) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(left) {
+		count = len(left)
+	}
+	d.pos += count
+	return left[:count], nil
+}
+
+// file opens torrent and cache reader on first read, so PROPFIND and HEAD don't start download
+type file struct {
+	user   string
+	hash   string
+	id     int
+	info   *fileInfo
+	pos    int64
+	tor    *torr.Torrent
+	reader *torrstor.Reader
+}
+
+func (f *file) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *file) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+func (f *file) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.info.size
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.pos = offset
+	return f.pos, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.pos >= f.info.size {
+		return 0, io.EOF
+	}
+	if f.reader == nil {
+		if err := f.openReader(); err != nil {
+			return 0, err
+		}
+	}
+	if f.reader.Offset() != f.pos {
+		if _, err := f.reader.Seek(f.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.reader.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *file) openReader() error {
+	tor := torr.GetTorrent(f.user, f.hash)
+	if tor == nil {
+		return os.ErrNotExist
+	}
+	if tor.Stat == state.TorrentInDB {
+		var err error
+		tor, err = torr.AddTorrent(f.user, tor.TorrentSpec, tor.Title, tor.Poster, tor.Data, tor.Category)
+		if err != nil {
+			return err
+		}
+	}
+	if !tor.GotInfo() {
+		return errors.New("timeout connection torrent")
+	}
+	reader, _, err := tor.OpenReader(f.id)
+	if err != nil {
+		return err
+	}
+	f.tor = tor
+	f.reader = reader
+	return nil
+}
+
+func (f *file) Close() error {
+	if f.reader != nil {
+		f.tor.CloseReader(f.reader)
+		f.reader = nil
+	}
+	return nil
+}
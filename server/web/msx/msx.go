@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -36,6 +38,24 @@ func hashUser(data, user string) (string, string) {
 	return apiutils.SplitHashUser(data, user)
 }
 
+var linkParam = regexp.MustCompile(`([?&]link=)([^&#]+)`)
+
+// signLinks adds stream tokens to stream and playlist links of action, MSX players can't send basic auth
+func signLinks(action, user string) string {
+	if !settings.HttpAuth {
+		return action
+	}
+	return linkParam.ReplaceAllStringFunc(action, func(m string) string {
+		val := linkParam.FindStringSubmatch(m)[2]
+		link, err := url.QueryUnescape(val)
+		if err != nil || strings.Contains(link, "://") || strings.HasPrefix(link, "magnet:?") {
+			return m
+		}
+		h, u := apiutils.SplitHashUser(link, user)
+		return m + apiutils.TokenQuery(h, u)
+	})
+}
+
 func trn(h, user string) (st, sc string) {
 	if h := torr.GetTorrent(user, h); h != nil {
 		if h := h.Status(); h != nil && h.Stat < 5 {
@@ -132,7 +152,7 @@ func SetupRoute(r gin.IRouter) {
 					},
 				}
 			}
-			r.R.S, r.R.D = http.StatusOK, map[string]any{"action": j.Data, "data": r.R.D}
+			r.R.S, r.R.D = http.StatusOK, map[string]any{"action": signLinks(j.Data, u), "data": r.R.D}
 		}
 		r.R.T = http.StatusText(r.R.S)
 		c.JSON(http.StatusOK, &r)
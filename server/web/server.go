@@ -1,10 +1,15 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"net"
+	"net/http"
 	"os"
 	"sort"
+	"sync"
 
+	"server/dlna"
 	"server/rutor"
 
 	"github.com/gin-contrib/cors"
@@ -21,12 +26,17 @@ import (
 	"server/web/api"
 	"server/web/auth"
 	"server/web/blocker"
+	"server/web/dav"
 	"server/web/pages"
 	"server/web/sslcerts"
 )
 
 var (
-	waitChan = make(chan error)
+	waitChan = make(chan error, 3)
+
+	httpServers []*http.Server
+	muServers   sync.Mutex
+	stopOnce    sync.Once
 )
 
 //	@title			Swagger Torrserver API
@@ -67,12 +77,21 @@ func Start() {
 
 	route := gin.New()
 	route.Use(log.WebLogger(), blocker.Blocker(), gin.Recovery(), cors.New(corsCfg), location.Default())
+	auth.OnAccountsChange(func(added, removed []string) {
+		// new users get torrent server on first request
+		for _, user := range removed {
+			log.TLogln("Disconnect torrent server of removed user", user)
+			torr.DisconnectServer(user)
+		}
+	})
 	auth.SetupAuth(route)
 
 	route.GET("/echo", echo)
 
 	api.SetupRoute(route)
 	msx.SetupRoute(route)
+	dlna.SetupRoute(route)
+	dav.SetupRoute(route)
 	pages.SetupRoute(route)
 
 	// check if https enabled
@@ -92,34 +111,77 @@ func Start() {
 			log.TLogln("Saving path to ssl cert and key in db", settings.BTsets.SslCert, settings.BTsets.SslKey)
 			settings.SetBTSets(settings.BTsets)
 		}
+		srv := newServer(settings.IP+":"+settings.SslPort, route)
 		go func() {
-			log.TLogln("Start https server at", settings.IP+":"+settings.SslPort)
-			waitChan <- route.RunTLS(settings.IP+":"+settings.SslPort, settings.BTsets.SslCert, settings.BTsets.SslKey)
+			log.TLogln("Start https server at", srv.Addr)
+			serveDone(srv.ListenAndServeTLS(settings.BTsets.SslCert, settings.BTsets.SslKey))
 		}()
 	}
 
+	srv := newServer(settings.IP+":"+settings.Port, route)
 	go func() {
-		log.TLogln("Start http server at", settings.IP+":"+settings.Port)
-		waitChan <- route.Run(settings.IP + ":" + settings.Port)
+		log.TLogln("Start http server at", srv.Addr)
+		serveDone(srv.ListenAndServe())
 	}()
+
+	dlna.Start(ips)
+}
+
+func newServer(addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	muServers.Lock()
+	httpServers = append(httpServers, srv)
+	muServers.Unlock()
+	return srv
+}
+
+func serveDone(err error) {
+	if errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+	waitChan <- err
 }
 
 func Wait() error {
 	return <-waitChan
 }
 
+// Stop stops accepting new requests, waits settings.ShutdownTimeout for active streams,
+// closes left connections and disconnects torrent servers with their readers and caches
 func Stop() {
-	torr.DisconnectAllServers()
-	waitChan <- nil
+	stopOnce.Do(func() {
+		muServers.Lock()
+		servers := httpServers
+		muServers.Unlock()
+
+		dlna.Stop()
+		log.TLogln("Stop web servers, wait active requests", settings.ShutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, srv := range servers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := srv.Shutdown(ctx); err != nil {
+					log.TLogln("Close active connections of", srv.Addr, err)
+					srv.Close()
+				}
+			}()
+		}
+		wg.Wait()
+
+		log.TLogln("Disconnect torrent servers")
+		torr.DisconnectAllServers()
+		waitChan <- nil
+	})
 }
 
 func connectBTServers() error {
 	users := make([]string, 0)
 
 	if settings.HttpAuth {
-		for user := range auth.Accounts() {
-			users = append(users, user)
-		}
+		users = append(users, auth.Users()...)
 	}
 
 	if len(users) == 0 {
@@ -130,6 +192,7 @@ func connectBTServers() error {
 		if _, err := torr.ConnectServer(user); err != nil {
 			return err
 		}
+		torr.ResumeDownloads(user)
 	}
 
 	return nil
@@ -17,15 +17,18 @@ ptt.addHandler('season', /sezon[- |. ](\d{1,3})|(\d{1,3})[- |. ]sezon/i, { type:
 ptt.addHandler('season', /сезон[- |. ](\d{1,3})|(\d{1,3})[- |. ]сезон/i, { type: 'integer' })
 
 const Table = memo(
-  ({ playableFileList, viewedFileList, selectedSeason, seasonAmount, hash }) => {
+  ({ playableFileList, viewedFileList, selectedSeason, seasonAmount, hash, token }) => {
     const { t } = useTranslation()
     const [isSupported, setIsSupported] = useState(true)
-    const preloadBuffer = fileId => fetch(`${streamHost()}?link=${hash}&index=${fileId}&preload`)
+    const link = token ? `${hash}&token=${token}` : hash
+    const preloadBuffer = fileId => fetch(`${streamHost()}?link=${link}&index=${fileId}&preload`)
     const getFileLink = (path, id) =>
-      `${streamHost()}/${encodeURIComponent(path.split('\\').pop().split('/').pop())}?link=${hash}&index=${id}&play`
+      `${streamHost()}/${encodeURIComponent(path.split('\\').pop().split('/').pop())}?link=${link}&index=${id}&play`
     const fileHasEpisodeText = !!playableFileList?.find(({ path }) => ptt.parse(path).episode)
     const fileHasSeasonText = !!playableFileList?.find(({ path }) => ptt.parse(path).season)
-    const fileHasResolutionText = !!playableFileList?.find(({ path }) => ptt.parse(path).resolution)
+    // resolution from ffprobe result stored on server, falls back to file name
+    const getResolution = (path, media) => (media?.height ? `${media.height}p` : ptt.parse(path).resolution)
+    const fileHasResolutionText = !!playableFileList?.find(({ path, media }) => getResolution(path, media))
 
     // if files in list is more then 1 and no season text detected by ptt.parse, show full name
     const shouldDisplayFullFileName = playableFileList?.length > 1 && !fileHasEpisodeText
@@ -50,8 +53,9 @@ const Table = memo(
           </thead>
 
           <tbody>
-            {playableFileList.map(({ id, path, length }) => {
-              const { title, resolution, episode, season } = ptt.parse(path)
+            {playableFileList.map(({ id, path, length, media }) => {
+              const { title, episode, season } = ptt.parse(path)
+              const resolution = getResolution(path, media)
               const isViewed = viewedFileList?.includes(id)
               const link = getFileLink(path, id)
 
@@ -93,8 +97,9 @@ const Table = memo(
         </TableStyle>
 
         <ShortTableWrapper>
-          {playableFileList.map(({ id, path, length }) => {
-            const { title, resolution, episode, season } = ptt.parse(path)
+          {playableFileList.map(({ id, path, length, media }) => {
+            const { title, episode, season } = ptt.parse(path)
+            const resolution = getResolution(path, media)
             const isViewed = viewedFileList?.includes(id)
             const link = getFileLink(path, id)
 
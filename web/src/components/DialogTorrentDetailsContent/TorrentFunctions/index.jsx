@@ -10,7 +10,7 @@ import { SmallLabel, MainSectionButtonGroup } from './style'
 import { SectionSubName } from '../style'
 
 const TorrentFunctions = memo(
-  ({ hash, viewedFileList, playableFileList, name, title, setViewedFileList }) => {
+  ({ hash, token, viewedFileList, playableFileList, name, title, setViewedFileList }) => {
     const { t } = useTranslation()
     const latestViewedFileId = viewedFileList?.[viewedFileList?.length - 1]
     const latestViewedFile = playableFileList?.find(({ id }) => id === latestViewedFileId)?.path
@@ -19,7 +19,8 @@ const TorrentFunctions = memo(
     const dropTorrent = () => axios.post(torrentsHost(), { action: 'drop', hash })
     const removeTorrentViews = () =>
       axios.post(viewedHost(), { action: 'rem', hash, file_index: -1 }).then(() => setViewedFileList())
-    const fullPlaylistLink = `${playlistTorrHost()}/${encodeURIComponent(name || title || 'file')}.m3u?link=${hash}&m3u`
+    const link = token ? `${hash}&token=${token}` : hash
+    const fullPlaylistLink = `${playlistTorrHost()}/${encodeURIComponent(name || title || 'file')}.m3u?link=${link}&m3u`
     const partialPlaylistLink = `${fullPlaylistLink}&fromlast`
     const magnet = `magnet:?xt=urn:btih:${hash}&dn=${encodeURIComponent(name || title)}`
 
@@ -50,6 +50,7 @@ export default function DialogTorrentDetailsContent({ closeDialog, torrent }) {
   const {
     poster,
     hash,
+    token,
     title,
     category,
     name,
@@ -192,6 +193,7 @@ export default function DialogTorrentDetailsContent({ closeDialog, torrent }) {
 
                 <TorrentFunctions
                   hash={hash}
+                  token={token}
                   viewedFileList={viewedFileList}
                   playableFileList={playableFileList}
                   name={name}
@@ -251,6 +253,7 @@ export default function DialogTorrentDetailsContent({ closeDialog, torrent }) {
 
               <Table
                 hash={hash}
+                token={token}
                 playableFileList={playableFileList}
                 viewedFileList={viewedFileList}
                 selectedSeason={selectedSeason}
@@ -56,9 +56,12 @@ const Torrent = ({ torrent }) => {
     torrent_size: torrentSize,
     download_speed: downloadSpeed,
     hash,
+    token,
     stat,
     data,
   } = torrent
+  // signed token lets external players open links without basic auth
+  const link = token ? `${hash}&token=${token}` : hash
 
   const dropTorrent = () => axios.post(torrentsHost(), { action: 'drop', hash })
   const deleteTorrent = () => axios.post(torrentsHost(), { action: 'rem', hash })
@@ -83,14 +86,14 @@ const Torrent = ({ torrent }) => {
   const handleClickOpenEditDialog = () => setIsEditDialogOpen(true)
   const handleCloseEditDialog = () => setIsEditDialogOpen(false)
 
-  const fullPlaylistLink = `${playlistTorrHost()}/${encodeURIComponent(parsedTitle || 'file')}.m3u?link=${hash}&m3u`
+  const fullPlaylistLink = `${playlistTorrHost()}/${encodeURIComponent(parsedTitle || 'file')}.m3u?link=${link}&m3u`
 
   const detailedInfoDialogRef = useOnStandaloneAppOutsideClick(closeDetailedInfo)
   // main categories
   const catIndex = TORRENT_CATEGORIES.findIndex(e => e.key === category)
   const catArray = TORRENT_CATEGORIES.find(e => e.key === category)
   const getFileLink = (path, id) =>
-    `${streamHost()}/${encodeURIComponent(path.split('\\').pop().split('/').pop())}?link=${hash}&index=${id}&play`
+    `${streamHost()}/${encodeURIComponent(path.split('\\').pop().split('/').pop())}?link=${link}&index=${id}&play`
 
   const fileList = (data && JSON.parse(data).TorrServer?.Files) || []
   const playableVideoList = fileList.filter(({ path }) => isFilePlayable(path))